@@ -0,0 +1,231 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleFabricVer string
+	bundleSeedVer   string
+	bundleFabricUrl string
+	bundleSeedUrl   string
+	bundlePlatforms []string
+)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Packages everything configure needs for an air-gapped network",
+	Long: "A bundle holds the FAST and seed checkouts at a tag, the " +
+		"terraform modules they use, a mirror of the terraform providers " +
+		"they require and the versions it was built with. Create it " +
+		"where GitHub and the terraform registry are reachable, then " +
+		"import it on the restricted machine before running configure.",
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create ARCHIVE",
+	Short: "Creates a bundle archive",
+	Long: "Creates a .tar.gz bundle of the FAST and seed versions. Providers " +
+		"are mirrored for each --platform, which defaults to the platform " +
+		"of this binary; add the platform of the restricted machine when " +
+		"it differs, e.g. --platform linux_amd64.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		opts := &fabric.BundleOptions{
+			PastureVersion: pastureVer,
+			FastUrl:        bundleFabricUrl,
+			FastVersion:    bundleFabricVer,
+			SeedUrl:        bundleSeedUrl,
+			SeedVersion:    bundleSeedVer,
+			Platforms:      bundlePlatforms,
+			Verbose:        verbose,
+		}
+
+		output.Infof(
+			"Bundling FAST %s and seeds %s for %s",
+			bundleFabricVer, bundleSeedVer, strings.Join(bundlePlatforms, ", "),
+		)
+
+		b, err := fabric.CreateBundle(path, args[0], opts)
+		if err != nil {
+			output.Error("Unable to create bundle:", args[0])
+			output.CheckErr(output.Terraform, err)
+		}
+
+		output.Set("bundle", b)
+		output.Info("Bundle written to:", args[0])
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import ARCHIVE",
+	Short: "Imports a bundle archive",
+	Long: "Imports a bundle into the clone cache and points terraform at " +
+		"its provider mirror, with the registry disabled. Configure then " +
+		"uses the FAST and seed versions of the bundle unless told " +
+		"otherwise. Set TF_CLI_CONFIG_FILE to use a terraform CLI " +
+		"configuration of your own instead.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		b, err := fabric.ImportBundle(path, args[0])
+		if err != nil {
+			output.Error("Unable to import bundle:", args[0])
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Set("bundle", b)
+
+		if b.PastureVersion != pastureVer {
+			output.Warn(fmt.Sprintf(
+				"The bundle was created by pasture %s, this is %s",
+				b.PastureVersion, pastureVer,
+			))
+		}
+
+		if !slices.Contains(b.Platforms, fabric.DefaultPlatform()) {
+			output.Warn(fmt.Sprintf(
+				"The bundle has no providers for %s, only %s",
+				fabric.DefaultPlatform(), strings.Join(b.Platforms, ", "),
+			))
+		}
+
+		output.Infof(
+			"Imported FAST %s and seeds %s",
+			tagName(b.Fast.Ref), tagName(b.Seed.Ref),
+		)
+	},
+}
+
+var bundleRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Removes the imported bundle",
+	Long: "Removes the imported bundle so terraform installs providers " +
+		"from their registries again. Its checkouts stay in the cache.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		if err := fabric.RemoveBundle(path); err != nil {
+			output.Error("Unable to remove the bundle")
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Info("Bundle removed")
+	},
+}
+
+// useBundleDefaults makes configure use the checkouts of an imported bundle
+// unless versions or repositories are set explicitly
+func useBundleDefaults(cmd *cobra.Command, path string) {
+	b, err := fabric.ImportedBundle(path)
+	if err != nil {
+		output.Error("Unable to read the imported bundle")
+		output.CheckErr(output.Preflight, err)
+	}
+
+	if b == nil {
+		return
+	}
+
+	flags := cmd.Flags()
+
+	if !flags.Changed("fabric-version") {
+		fabricVer = tagName(b.Fast.Ref)
+	}
+
+	if !flags.Changed("fabric-repo") {
+		fabricRepoUrl = b.Fast.Url
+	}
+
+	if !flags.Changed("seed-version") {
+		seedVer = tagName(b.Seed.Ref)
+	}
+
+	if !flags.Changed("seed-repo") {
+		seedRepoUrl = b.Seed.Url
+	}
+
+	output.Info(
+		"Using the imported bundle created",
+		b.Created.Local().Format("2006-01-02 15:04"),
+	)
+}
+
+func tagName(ref string) string {
+	return strings.TrimPrefix(ref, "refs/tags/")
+}
+
+func init() {
+	fast, _ := fabric.RepoURL("fast")
+	seed, _ := fabric.RepoURL("seed")
+
+	bundleCreateCmd.Flags().
+		StringVar(
+			&bundleFabricVer, "fabric-version", "v32.0.0",
+			"Cloud Foundation Fabric FAST version",
+		)
+	bundleCreateCmd.Flags().
+		StringVar(
+			&bundleSeedVer, "seed-version", pastureVer,
+			"Pasture seed version",
+		)
+	bundleCreateCmd.Flags().
+		StringVar(
+			&bundleFabricUrl, "fabric-repo", fast,
+			"URL of the FAST repository or a mirror of it",
+		)
+	bundleCreateCmd.Flags().
+		StringVar(
+			&bundleSeedUrl, "seed-repo", seed,
+			"URL of the seed repository or a mirror of it",
+		)
+	bundleCreateCmd.Flags().
+		StringSliceVar(
+			&bundlePlatforms, "platform", []string{fabric.DefaultPlatform()},
+			"Terraform platforms to mirror providers for (comma separated)",
+		)
+
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleCmd.AddCommand(bundleRemoveCmd)
+
+	// Add the bundle command to the root command
+	RootCmd.AddCommand(bundleCmd)
+}
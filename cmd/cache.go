@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheRepo string
+	cacheUrl  string
+	cacheRef  string
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manages the cache of FAST and seed checkouts",
+	Long: "Configure clones each tag of the FAST and seed repositories " +
+		"once, shallow, into a cache under the config path and copies it " +
+		"from there afterwards. Entries are keyed by repository URL and " +
+		"tag, so mirrors set with --fabric-repo or --seed-repo are cached " +
+		"on their own. Importing a tarball of a checkout fills the cache " +
+		"on machines that cannot reach the repository.",
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the cached checkouts",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := utils.ListCache(cachePath())
+		if err != nil {
+			output.Error("Unable to read the cache")
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Set("entries", entries)
+
+		if output.Structured() {
+			return
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("The cache is empty")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tURL\tREF\tCOMMIT\tSOURCE\tCREATED")
+
+		for _, e := range entries {
+			commit := e.Commit
+			if len(commit) > 12 {
+				commit = commit[:12]
+			} else if commit == "" {
+				commit = "-"
+			}
+
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Key,
+				e.Url,
+				e.Ref,
+				commit,
+				e.Source,
+				e.Created.Local().Format("2006-01-02 15:04"),
+			)
+		}
+
+		w.Flush()
+	},
+}
+
+var cacheImportCmd = &cobra.Command{
+	Use:   "import ARCHIVE",
+	Short: "Imports a .tar.gz of a checkout into the cache",
+	Long: "Imports a .tar.gz of a repository checkout, such as a GitHub " +
+		"release tarball, as the content of a repository at a tag. An " +
+		"example of importing FAST for an offline configure:\n\n\t" +
+		"pasture cache import cloud-foundation-fabric-32.0.0.tar.gz " +
+		"--repo fast --ref v32.0.0",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		url := cacheUrl
+
+		if url == "" {
+			u, err := fabric.RepoURL(cacheRepo)
+			if err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+
+			url = u
+		}
+
+		ref := cacheRef
+		if !strings.HasPrefix(ref, "refs/") {
+			ref = "refs/tags/" + ref
+		}
+
+		entry, err := utils.ImportArchive(cachePath(), args[0], url, ref)
+		if err != nil {
+			output.Error("Unable to import archive:", args[0])
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Set("entry", entry)
+		output.Info("Imported", args[0], "as", url, "at", ref)
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Removes every cached checkout",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := utils.ClearCache(cachePath()); err != nil {
+			output.Error("Unable to clear the cache")
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Info("Cache cleared")
+	},
+}
+
+func cachePath() string {
+	path, err := utils.ConfigPath()
+	if err != nil {
+		output.Error("Unable to set configuration path")
+		output.CheckErr(output.Preflight, err)
+	}
+
+	return utils.CachePath(path)
+}
+
+func init() {
+	cacheImportCmd.Flags().
+		StringVar(
+			&cacheRepo, "repo", "fast",
+			"Repository the archive holds (fast, seed)",
+		)
+	cacheImportCmd.Flags().
+		StringVar(
+			&cacheUrl, "url", "",
+			"URL of the mirror the archive holds, instead of --repo",
+		)
+	cacheImportCmd.Flags().
+		StringVar(
+			&cacheRef, "ref", "",
+			"Tag the archive holds, e.g. v32.0.0",
+		)
+
+	if err := cacheImportCmd.MarkFlagRequired("ref"); err != nil {
+		cobra.CheckErr(err)
+	}
+
+	cacheImportCmd.MarkFlagsMutuallyExclusive("repo", "url")
+
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheImportCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	// Add the cache command to the root command
+	RootCmd.AddCommand(cacheCmd)
+}
@@ -0,0 +1,360 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configViewRemote bool
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Views and edits the pasture configuration",
+	Long: "Views and edits the FAST configuration in " +
+		"pasture-fast.tfvars.json. Keys are dotted paths of the tfvars " +
+		"names, for example locations.gcs or groups.gcp-devops.",
+	Args: cobra.NoArgs,
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Prints the pasture configuration",
+	Long: "Prints the local pasture configuration and the file it was " +
+		"read from. Use --remote to print the copy in the outputs bucket.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		vars, _ := loadLocalConfig()
+		source := vars.LocalPath
+		data, err := utils.ReadFile(vars.LocalPath)
+
+		if configViewRemote {
+			source = "gs://" + vars.Bucket + "/" + vars.RemotePath
+			data, err = google.ReadObject(vars.Bucket, vars.RemotePath)
+		}
+
+		if err != nil {
+			output.Error("Unable to read configuration from:", source)
+			output.CheckErr(output.Storage, err)
+		}
+
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		output.Set("source", source)
+		output.Set("config", doc)
+
+		if !output.Structured() {
+			pretty, _ := json.MarshalIndent(doc, "", "    ")
+			fmt.Println("# Source:", source)
+			fmt.Println(string(pretty))
+		}
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Prints a single configuration value",
+	Long: "Prints the value at a dotted key of the local pasture " +
+		"configuration. An example:\n\n\tpasture config get locations.gcs",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, local := loadLocalConfig()
+
+		v, err := local.Get(args[0])
+		if err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		output.Set("key", args[0])
+		output.Set("value", v)
+
+		if !output.Structured() {
+			fmt.Println(formatValue(v))
+		}
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY=VALUE...",
+	Short: "Changes configuration values",
+	Long: "Changes values in the local pasture configuration. Values are " +
+		"checked against the type of each key; lists take comma separated " +
+		"values and objects take JSON. Use config diff to compare the " +
+		"result with the outputs bucket. An example:\n\n\t" +
+		"pasture config set locations.gcs=EU locations.bq=EU",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vars, local := loadLocalConfig()
+
+		current := fabric.NewFastConfig()
+		if err := current.ReadConfig(vars.LocalPath); err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		for _, a := range args {
+			k, v, ok := strings.Cut(a, "=")
+			if !ok {
+				output.CheckErr(
+					output.Usage,
+					fmt.Errorf("expected KEY=VALUE, got %q", a),
+				)
+			}
+
+			if err := local.Set(k, v); err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+		}
+
+		if err := local.Validate(); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		changes, err := fabric.DiffConfig(current, local)
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		output.Set("changes", changes)
+
+		if len(changes) == 0 {
+			output.Info("Configuration is already up to date")
+			return
+		}
+
+		if err := local.WriteConfig(vars.LocalPath); err != nil {
+			output.Error("Unable to write config file to path")
+			output.CheckErr(output.Storage, err)
+		}
+
+		for _, c := range changes {
+			output.Infof("%s: %s -> %s", c.Key, diffValue(c.Old), diffValue(c.New))
+		}
+
+		output.Info("Configuration written to:", vars.LocalPath)
+	},
+}
+
+var configDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compares the local and remote configuration",
+	Long: "Compares the local pasture configuration with the copy in the " +
+		"outputs bucket, showing each key as remote -> local.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		vars, local := loadLocalConfig()
+
+		// the remote copy is read like the local one, migrated and with
+		// the keys pasture does not know kept
+		dir, err := os.MkdirTemp("", "pasture-config")
+		if err != nil {
+			output.CheckErr(output.Storage, err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		remotePath, err := vars.DownloadCopy(dir)
+		if err != nil {
+			output.Error("Unable to read remote configuration")
+			output.CheckErr(output.Storage, err)
+		}
+
+		remote := fabric.NewFastConfig()
+		if err := remote.ReadConfig(remotePath); err != nil {
+			output.Error("Unable to read remote configuration")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		changes, err := fabric.DiffConfig(remote, local)
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		output.Set("changes", changes)
+
+		if len(changes) == 0 {
+			output.Info("Local configuration matches the outputs bucket")
+			return
+		}
+
+		for _, c := range changes {
+			output.Infof("%s: %s -> %s", c.Key, diffValue(c.Old), diffValue(c.New))
+		}
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Saves the configuration in the current schema",
+	Long: "Configurations written by older pasture releases are migrated " +
+		"in memory when they are read. This saves the migrated local " +
+		"configuration, which create also does before running terraform. " +
+		"Use config diff to compare the result with the outputs bucket.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		vars, local := loadLocalConfig()
+
+		from := 0
+		if local.Meta != nil {
+			from = local.Meta.SchemaVersion
+		}
+
+		migrated, err := local.MigrateConfig(vars.LocalPath)
+		if err != nil {
+			output.Error("Unable to write config file to path")
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Set("migrated", migrated)
+		output.Set("schema_version", fabric.ConfigSchemaVersion)
+
+		if !migrated {
+			output.Info("Configuration already uses schema", fabric.ConfigSchemaVersion)
+			return
+		}
+
+		output.Infof(
+			"Configuration migrated from schema %d to %d: %s",
+			from, fabric.ConfigSchemaVersion, vars.LocalPath,
+		)
+	},
+}
+
+var configDefaultsCmd = &cobra.Command{
+	Use:   "defaults [COMMAND...]",
+	Short: "Shows the effective flag defaults and their source",
+	Long: "Shows the value every flag takes when it is not given on the " +
+		"command line, and where the value comes from. Values are taken " +
+		"from, in order of precedence: the command line, a PASTURES_* " +
+		"environment variable, the config file ($HOME/.pastures.yaml, " +
+		"--config or $PASTURES_CONFIG), then the built-in default.\n\n" +
+		"Config file keys are the command path and flag name, e.g. " +
+		"create.data-cloud.region, and the environment variable is the " +
+		"key in upper case with dots and dashes replaced by underscores, " +
+		"e.g. PASTURES_CREATE_DATA_CLOUD_REGION. A bare flag name such as " +
+		"verbose applies to every command with that flag. An example:" +
+		"\n\n\tpasture config defaults create data-cloud",
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		target := cmd.Root()
+
+		if len(args) > 0 {
+			c, rest, err := target.Find(args)
+			if err != nil || len(rest) > 0 {
+				output.CheckErr(
+					output.Usage,
+					fmt.Errorf("unknown command %q", strings.Join(args, " ")),
+				)
+			}
+
+			target = c
+		}
+
+		settings := commandSettings(target)
+
+		output.Set("config_file", viper.ConfigFileUsed())
+		output.Set("settings", settings)
+
+		if output.Structured() {
+			return
+		}
+
+		if f := viper.ConfigFileUsed(); f != "" {
+			fmt.Println("Config file:", f)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+
+		for _, s := range settings {
+			source := s.Source
+			if s.Source == sourceEnv {
+				source += " (" + s.Env + ")"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Value, source)
+		}
+
+		w.Flush()
+	},
+}
+
+// loadLocalConfig reads the local configuration and its vars file
+func loadLocalConfig() (*fabric.VarsFile, *fabric.FastConfig) {
+	path, err := utils.ConfigPath()
+	if err != nil {
+		output.Error("Unable to set configuration path")
+		output.CheckErr(output.Preflight, err)
+	}
+
+	vars := fabric.LoadVarsFile(path, "")
+	config := fabric.NewFastConfig()
+
+	if err := config.ReadConfig(vars.LocalPath); err != nil {
+		output.Error("No pasture configured.", "Try running pasture configure")
+		output.CheckErr(output.Preflight, err)
+	}
+
+	vars.SetBucket(config.Prefix)
+
+	return vars, config
+}
+
+// formatValue prints strings as is and everything else as JSON
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	j, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(j)
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configDiffCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configDefaultsCmd)
+
+	configViewCmd.Flags().
+		BoolVar(
+			&configViewRemote, "remote", false,
+			"Print the configuration stored in the outputs bucket",
+		)
+}
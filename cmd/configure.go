@@ -17,17 +17,28 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/mod/semver"
 )
 
 const (
 	pastureVer = "v1.1.4" // x-release-please-version
+
+	// config file key holding log sink definitions
+	logSinksKey = "configure.log-sinks"
 )
 
 var (
@@ -35,6 +46,19 @@ var (
 	orgDomain        string
 	billingAccountId string
 	location         string
+	residency        string
+	bqLocation       string
+	gcsLocation      string
+	loggingLocation  string
+	pubsubLocations  []string
+	fastFeatures     []string
+	fastStageNames   []string
+	orgPolicyOverlay []string
+	firewallOverlay  []string
+	overlayProfile   string
+	fabricRepoUrl    string
+	fabricKeyring    string
+	seedRepoUrl      string
 	isInternal       bool
 	fabricVer        string
 	prefix           string
@@ -42,7 +66,10 @@ var (
 	orgAdminSa       string
 	rehydrate        bool
 	seedVer          string
+	seedPath         string
 	skipSeed         bool
+	configDryRun     bool
+	configUpdate     bool
 
 	// static variables for prerequisites, etc
 	reqBinaries = map[string]string{
@@ -64,20 +91,129 @@ var (
 	// global vars for other things TODO: these defaults likely belong somewhere else
 	gIamRoles         = []string{"roles/resourcemanager.organizationAdmin"}
 	gIamAdditiveRoles = []string{"roles/orgpolicy.policyAdmin"}
+)
+
+// locationFlags change the locations of an existing configuration
+var locationFlags = []string{
+	"location",
+	"residency",
+	"bq-location",
+	"gcs-location",
+	"logging-location",
+	"pubsub-locations",
+}
 
-	// patch FAST not making these unique with prefixes
-	logSinks = fabric.LogSinks{
-		"audit-logs": fabric.LogSink{
-			"filter": "logName:\"/logs/cloudaudit.googleapis.com%2Factivity\"" +
-				" OR logName:\"/logs/cloudaudit.googleapis.com%2Fsystem_event\"",
-			"type": "logging",
-		},
-		"vpc-sc": fabric.LogSink{
-			"filter": "protoPayload.metadata.@type=\"type.googleapis.com/google.cloud.audit.VpcServiceControlAuditMetadata\"",
-			"type":   "logging",
-		},
+// embeddedSeeds reports whether the seeds come from the binary, which is
+// the case unless another version, a repository or a local path is asked for
+func embeddedSeeds() bool {
+	return seedVer == pastureVer && seedRepoUrl == "" && seedPath == ""
+}
+
+// verifyFastCheckout checks the FAST checkout against the commit pinned for
+// its tag and, with --fabric-keyring, the signature of the tag
+func verifyFastCheckout(r *utils.Repo) error {
+	commit, err := r.Commit()
+	if err != nil {
+		return err
+	}
+
+	if err := fabric.VerifyFastCommit(fabricVer, commit); err != nil {
+		return err
+	}
+
+	if fabricKeyring == "" {
+		return nil
+	}
+
+	keyring, err := utils.ReadFile(fabricKeyring)
+	if err != nil {
+		return err
+	}
+
+	return r.VerifyTag(string(keyring))
+}
+
+// rehydratedFastVersion returns the FAST release to check out for a
+// rehydrated pasture: the one its config records, unless --fabric-version
+// is given, which may not be older than the recorded one
+func rehydratedFastVersion(cmd *cobra.Command, meta *fabric.ConfigMeta) (string, error) {
+	if meta == nil || meta.FastVersion == "" {
+		return fabricVer, nil
+	}
+
+	if !explicitlySet(cmd, "fabric-version") {
+		return meta.FastVersion, nil
+	}
+
+	if semver.Compare(fabricVer, meta.FastVersion) < 0 {
+		return "", fmt.Errorf(
+			"FAST %s is older than the %s of the pasture - downgrades are "+
+				"not supported", fabricVer, meta.FastVersion,
+		)
+	}
+
+	return fabricVer, nil
+}
+
+// resolveLocations builds the service locations from a residency preset
+// or --location, then applies the per-service flags. Without either,
+// current locations are kept.
+func resolveLocations(
+	cmd *cobra.Command,
+	current *fabric.Locations,
+) (*fabric.Locations, *fabric.Residency, error) {
+	var res *fabric.Residency
+
+	// an update only applies the flags given on the command line
+	set := cmd.Flags().Changed
+	if current != nil {
+		set = func(name string) bool { return explicitlySet(cmd, name) }
+	}
+
+	loc := current
+	if loc == nil || set("location") {
+		loc = fabric.NewLocations(location)
+	}
+
+	if residency != "" && set("residency") {
+		var err error
+		if res, err = fabric.GetResidency(residency); err != nil {
+			return nil, nil, err
+		}
+
+		loc = &res.Locations
 	}
-)
+
+	if set("bq-location") {
+		loc.Bq = bqLocation
+	}
+
+	if set("gcs-location") {
+		loc.Gcs = gcsLocation
+	}
+
+	if set("logging-location") {
+		loc.Logging = loggingLocation
+	}
+
+	if set("pubsub-locations") {
+		loc.PubSub = pubsubLocations
+	}
+
+	return loc, res, nil
+}
+
+// logSinkSettings overlays the log sinks defined under configure.log-sinks
+// in the config file on the FAST defaults
+func logSinkSettings() (fabric.LogSinks, error) {
+	overrides := make(fabric.LogSinks)
+
+	if err := viper.UnmarshalKey(logSinksKey, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid %s in config file: %w", logSinksKey, err)
+	}
+
+	return fabric.MergeLogSinks(fabric.DefaultLogSinks(), overrides), nil
+}
 
 // configureCmd represents the configure command
 var configureCmd = &cobra.Command{
@@ -85,17 +221,21 @@ var configureCmd = &cobra.Command{
 	Short: "Initializes environment configuration",
 	Long: "This command will create an environment and define its " +
 		"properties in a pasture configuration file, which is " +
-		"located by default at $HOME/.pastures/pasture.yaml.",
+		"located at $HOME/.pastures/pasture-fast.tfvars.json.\n\n" +
+		"When run in a terminal without --domain, --billing-account, " +
+		"--group-owner or --prefix, a guided setup discovers the available " +
+		"organizations, billing accounts and groups, proposes a prefix and " +
+		"asks for confirmation before any roles are granted.",
 	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// Check if prereqs are in place
-		fmt.Println("Running preflight checks")
+		output.Info("Running preflight checks")
 
 		for k, v := range reqBinaries {
 			if err := utils.CheckInstalled(k, v); err != nil {
-				fmt.Println("Preflight checks failed")
-				cobra.CheckErr(err)
+				output.Error("Preflight checks failed")
+				output.CheckErr(output.Preflight, err)
 			}
 		}
 
@@ -103,72 +243,164 @@ var configureCmd = &cobra.Command{
 		path, err := utils.ConfigPath()
 
 		if err != nil {
-			cobra.CheckErr(err)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		// An imported bundle replaces GitHub for the checkouts
+		useBundleDefaults(cmd, path)
+
+		// Collect side effects instead of performing them
+		var preview *configurePreview
+
+		if configDryRun {
+			preview = &configurePreview{}
+
+			if _, err := os.Stat(path); err != nil {
+				preview.Directories = append(preview.Directories, path)
+			}
+		} else {
+			output.Info("Creating config directory at:", path)
+			if err := utils.CreateDir(path); err != nil {
+				output.Info("Config directory already exists at:", path)
+			}
 		}
 
-		fmt.Println("Creating config directory at:", path)
-		if err := utils.CreateDir(path); err != nil {
-			fmt.Println("Config directory already exists at:", path)
+		// Authorize with Google and get current user
+		email, err := google.AppDefaultCredentials()
+
+		if err != nil {
+			output.Error("Unable to authorize with Google")
+			output.CheckErr(output.Auth, err)
+		}
+
+		history.SetUser(email)
+
+		// Prompt for anything missing when running in a terminal
+		if missing := missingConfigureFlags(); len(missing) > 0 {
+			if !canPrompt() {
+				err := fmt.Errorf(
+					"missing required flags: %s", strings.Join(missing, ", "),
+				)
+				output.CheckErr(output.Usage, err)
+			}
+
+			ok, err := runWizard(
+				path,
+				!cmd.Flags().Changed("location") && residency == "",
+				preview,
+			)
+			if err != nil {
+				output.Error("Guided setup failed")
+				output.CheckErr(output.Preflight, err)
+			}
+
+			if !ok {
+				output.Info("Configure cancelled - no changes were made")
+				return
+			}
 		}
 
 		// Create a new variable file instance
 		vars := fabric.LoadVarsFile(path, prefix)
+		history.SetBucket(vars.Bucket)
+		history.SetFastRef(fabricVer)
 
 		// TODO: if requested, print the foundations directory path
 		// (to be enhanced with harvest feature)
 
-		// Authorize with Google and get current user
-		email, err := google.AppDefaultCredentials()
+		// Change an existing configuration in place
+		if configUpdate {
+			updateConfig(cmd, vars, preview)
 
-		if err != nil {
-			fmt.Println("Unable to authorize with Google")
-			cobra.CheckErr(err)
+			if preview != nil {
+				preview.print()
+				output.Info("\nDry run complete - no changes were made")
+			}
+
+			output.Set("prefix", prefix)
+			output.Set("config_file", vars.LocalPath)
+
+			return
 		}
 
 		// Establish a tfvars file from somewhere
 		if rehydrate {
-			fmt.Println("Sourcing existing configuration from GCS bucket")
+			output.Info("Sourcing existing configuration from GCS bucket")
 
 			// download the tfvars file
-			if err := vars.DownloadFile(); err != nil {
-				fmt.Println("Cannot download existing pastures configuration")
-				cobra.CheckErr(err)
+			if preview != nil {
+				if err := vars.GetFileMetadata(); err != nil {
+					output.Error("Cannot find existing pastures configuration")
+					output.CheckErr(output.Storage, err)
+				}
+
+				preview.Downloads = append(
+					preview.Downloads,
+					fmt.Sprintf(
+						"gs://%s/%s -> %s",
+						vars.Bucket, vars.RemotePath, vars.LocalPath,
+					),
+				)
+			} else if err := vars.DownloadFile(); err != nil {
+				output.Error("Cannot download existing pastures configuration")
+				output.CheckErr(output.Storage, err)
 			}
 		} else {
-			fmt.Println("Building a new configuration file")
+			output.Info("Building a new configuration file")
 
 			if err := vars.GetFileMetadata(); err == nil {
 				err := fmt.Errorf(
-					"existing pasture for prefix %s found - "+
-						"try running configure with --rehydrate flag", prefix,
+					"existing pasture for prefix %s found - try running "+
+						"configure with --rehydrate or --update flag", prefix,
 				)
-				cobra.CheckErr(err)
+				output.CheckErr(output.Preflight, err)
 			}
 
 			// Build fastConfig struct
 			fastConfig := fabric.NewFastConfig()
 
 			if err := fastConfig.SetOrg(orgDomain); err != nil {
-				cobra.CheckErr(err)
+				output.CheckErr(output.Auth, err)
 			}
 			fastConfig.SetBilling(billingAccountId, isInternal)
 			fastConfig.SetUser(email)
 
 			// Enable sandbox for seeds
-			if skipSeed {
-				fastConfig.SetFeatures(false)
-			} else {
-				fastConfig.SetFeatures(true)
+			features := slices.Clone(fastFeatures)
+			if !skipSeed {
+				features = append(features, "sandbox")
+			}
+
+			if err := fastConfig.SetFeatures(features...); err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+
+			if err := fastConfig.SetStages(fastStageNames...); err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+
+			loc, res, err := resolveLocations(cmd, nil)
+			if err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+
+			if err := fastConfig.SetLocations(loc); err != nil {
+				output.Error("Invalid locations")
+				output.CheckErr(output.Usage, err)
 			}
 
-			fastConfig.SetLocations(location)
+			if res != nil {
+				fastConfig.SetResidency(res)
+			}
 
 			if err := fastConfig.SetPrefix(prefix); err != nil {
-				fmt.Println("Prefix must be less than 10 characters")
-				cobra.CheckErr(err)
+				output.Error("Invalid prefix:", prefix)
+				output.CheckErr(output.Preflight, err)
 			}
 
 			fastConfig.SetGroups(group)
+			fastConfig.SetVersions(fabricVer, seedVer)
+			fastConfig.SetSeedPath(seedPath)
 
 			// Add IAM policies to vars struct
 			if isInternal {
@@ -180,7 +412,7 @@ var configureCmd = &cobra.Command{
 					)
 
 					if err != nil {
-						cobra.CheckErr(err)
+						output.CheckErr(output.General, err)
 					}
 				}
 
@@ -193,44 +425,125 @@ var configureCmd = &cobra.Command{
 				}
 
 				if err := fastConfig.AddIamMember(adds); err != nil {
-					fmt.Println("Unable to set IAM additive policy")
-					cobra.CheckErr(err)
+					output.Error("Unable to set IAM additive policy")
+					output.CheckErr(output.General, err)
 				}
+			}
+
+			// Prefixed log sinks, as FAST does not make them unique
+			sinks, err := logSinkSettings()
+			if err != nil {
+				output.CheckErr(output.Usage, err)
+			}
 
-				// Customize log sinks
-				// TODO: refactor to simple slice and iterate in method
-				fastConfig.SetLogSinks(prefix, logSinks)
+			if err := fastConfig.SetLogSinks(prefix, sinks); err != nil {
+				output.Error("Invalid log sinks")
+				output.CheckErr(output.Usage, err)
 			}
 
-			fmt.Println("Applying prerequisite roles to group:", group)
+			if preview != nil {
+				delta, err := google.OrgIAMDelta(
+					fastConfig.Organization,
+					group,
+					groupIamRoles,
+				)
+				if err != nil {
+					output.Error("Unable to read organization IAM policy")
+					output.CheckErr(output.Auth, err)
+				}
+
+				j, err := fastConfig.Marshal()
+				if err != nil {
+					output.CheckErr(output.General, err)
+				}
 
-			if err := google.SetRequiredOrgIAMRoles(
-				fastConfig.Organization,
-				group,
-				groupIamRoles,
-			); err != nil {
-				fmt.Println("Unable to apply prerequisite roles to group:", group)
-				cobra.CheckErr(err)
+				preview.Iam = delta
+				preview.ConfigFile = vars.LocalPath
+				preview.Config = j
+			} else {
+				output.Info("Applying prerequisite roles to group:", group)
+
+				if err := google.SetRequiredOrgIAMRoles(
+					fastConfig.Organization,
+					group,
+					groupIamRoles,
+				); err != nil {
+					output.Error("Unable to apply prerequisite roles to group:", group)
+					output.CheckErr(output.Auth, err)
+				}
+
+				output.Info("Waiting for role assignment propagation")
+
+				// TODO: 10 seconds may or may not be enough for propagation
+				time.Sleep(10 * time.Second)
+
+				// Write the tfvars file
+				output.Info("Writing configuration file to path:", vars.LocalPath)
+
+				vars.AddConfig(fastConfig)
+
+				if err := vars.Config.WriteConfig(vars.LocalPath); err != nil {
+					output.Error("Unable to write config file to path")
+					output.CheckErr(output.Storage, err)
+				}
 			}
+		}
 
-			fmt.Println("Waiting for role assignment propagation")
+		// Init FAST stages, using the stages of a rehydrated pasture
+		selected := fastStageNames
 
-			// TODO: 10 seconds may or may not be enough for propagation
-			time.Sleep(10 * time.Second)
+		if rehydrate {
+			rehydrated := fabric.NewFastConfig()
+			configPath := vars.LocalPath
+
+			// a dry run reads a copy, leaving the local config as it is
+			if preview != nil {
+				dir, err := os.MkdirTemp("", "pasture-config")
+				if err != nil {
+					output.CheckErr(output.Storage, err)
+				}
 
-			// Write the tfvars file
-			fmt.Println("Writing configuration file to path:", vars.LocalPath)
+				defer os.RemoveAll(dir)
+
+				if configPath, err = vars.DownloadCopy(dir); err != nil {
+					output.Error("Cannot download existing pastures configuration")
+					output.CheckErr(output.Storage, err)
+				}
+			}
 
-			vars.AddConfig(fastConfig)
+			if err := rehydrated.ReadConfig(configPath); err != nil {
+				output.Error("Unable to read existing configuration")
+				output.CheckErr(output.Preflight, err)
+			}
 
-			if err := vars.Config.WriteConfig(vars.LocalPath); err != nil {
-				fmt.Println("Unable to write config file to path")
-				cobra.CheckErr(err)
+			if preview == nil {
+				if _, err := rehydrated.MigrateConfig(configPath); err != nil {
+					output.Error("Unable to save the migrated configuration")
+					output.CheckErr(output.Storage, err)
+				}
 			}
+
+			selected = rehydrated.Stages()
+
+			ver, err := rehydratedFastVersion(cmd, rehydrated.Meta)
+			if err != nil {
+				output.CheckErr(output.Usage, err)
+			}
+
+			fabricVer = ver
+			history.SetFastRef(fabricVer)
 		}
 
-		// Init FAST stages
-		stages := fabric.InitializeFoundationStages(path, prefix, vars)
+		stages := fabric.InitializeFoundationStages(
+			path,
+			prefix,
+			selected,
+			vars,
+		)
+
+		if err := checkOverlays(stages); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
 
 		// Create seed stage shell and append to foundations
 		if !skipSeed {
@@ -238,43 +551,135 @@ var configureCmd = &cobra.Command{
 		}
 
 		for i, s := range stages {
-			// clone repositories
-			if s.Type == "foundation" {
-				if i > 0 { // we only need to deal with foundation once
-					continue
-				} else {
-					fmt.Printf("Using %s tag for Fabric FAST \n", fabricVer)
+			// clone repositories, we only need to deal with foundation once
+			if s.Type == "seed" || i == 0 {
+				if s.Type == "foundation" {
+					output.Infof("Using %s tag for Fabric FAST", fabricVer)
 					s.Repository.SetRef("refs/tags/" + fabricVer)
+
+					if !fabric.TestedFastVersion(fabricVer) {
+						output.Warn(fmt.Sprintf(
+							"FAST %s is not tested with pasture %s - tested "+
+								"versions are %s",
+							fabricVer,
+							pastureVer,
+							strings.Join(fabric.TestedFastVersions(), ", "),
+						))
+					}
+
+					if fabricRepoUrl != "" {
+						s.Repository.SetURL(fabricRepoUrl)
+					}
+				} else if seedPath != "" {
+					output.Info("Using the seeds in", seedPath)
+					if err := s.UseLocalSeeds(seedPath); err != nil {
+						output.Error("Unable to use the seeds in", seedPath)
+						output.CheckErr(output.Usage, err)
+					}
+				} else if embeddedSeeds() {
+					output.Infof("Using the seeds embedded in pasture %s", pastureVer)
+					s.UseEmbeddedSeeds(path)
+				} else {
+					// TODO: we don't have a seed name here; just a shell
+					output.Infof(
+						"Using %s tag for the Pasture seed %s",
+						seedVer, s.Name,
+					)
+					s.Repository.SetRef("refs/tags/" + seedVer)
+
+					if seedRepoUrl != "" {
+						s.Repository.SetURL(seedRepoUrl)
+					}
+				}
+
+				// make sure the tag exists before anything is cloned
+				if s.Embedded == "" && s.Local == "" {
+					if err := s.Repository.CheckRef(); err != nil {
+						output.Error(
+							"Unable to find", s.Repository.Ref,
+							"in", s.Repository.Url,
+						)
+
+						if errors.Is(err, utils.ErrRefNotFound) {
+							output.CheckErr(output.Usage, err)
+						}
+						output.CheckErr(output.General, err)
+					}
+				}
+
+				if s.Local != "" {
+					// a local working tree is linked as is
+					if preview != nil {
+						preview.Symlinks = append(preview.Symlinks, s.Repository.Link)
+					}
+				} else if preview != nil && s.Embedded != "" {
+					preview.Directories = append(preview.Directories, s.Embedded)
+					preview.Symlinks = append(preview.Symlinks, s.Repository.Link)
+				} else if preview != nil {
+					preview.addRepo(s.Repository)
+				} else if s.Embedded != "" {
+					output.Info("Extracting seeds to:", s.Embedded)
+					if err := s.ExtractSeeds(); err != nil {
+						output.Error("Unable to extract seeds")
+						output.CheckErr(output.Storage, err)
+					}
+				} else {
+					output.Info("Cloning repository for", s.Type)
+					if err := s.Repository.Clone(false); err != nil {
+						output.Error("Unable to clone repository")
+						output.CheckErr(output.General, err)
+					}
+				}
+
+				if preview == nil && s.Type == "foundation" {
+					if err := verifyFastCheckout(s.Repository); err != nil {
+						output.Error("Unable to verify the FAST checkout")
+						output.CheckErr(output.Preflight, err)
+					}
+				}
+
+				// symlink relevant subdirs
+				if preview == nil {
+					if err := s.Repository.Link.Link(); err != nil {
+						output.Error(
+							"Unable to link repository target to directory",
+						)
+						output.CheckErr(output.Storage, err)
+					}
 				}
-			} else if s.Type == "seed" {
-				// TODO: we don't have a seed name here; just a shell
-				fmt.Printf(
-					"Using %s tag for the Pasture seed %s \n",
-					seedVer, s.Name,
-				)
-				s.Repository.SetRef("refs/tags/" + seedVer)
 			}
 
-			fmt.Println("Cloning repository for", s.Type)
-			if err := s.Repository.Clone(false); err != nil {
-				fmt.Println("Unable to clone repository")
-				cobra.CheckErr(err)
+			// configure stage factories
+			factories, reverts, err := stageFactories(path, s)
+			if err != nil {
+				output.CheckErr(output.Usage, err)
 			}
 
-			// symlink relevant subdirs
-			if err := s.Repository.Link.Link(); err != nil {
-				fmt.Println("Unable to link repository target to directory")
-				cobra.CheckErr(err)
+			for _, f := range reverts {
+				if preview != nil {
+					preview.Factories = append(preview.Factories, f.Target())
+					continue
+				}
+
+				output.Infof("Reverting %s factory of %s", f.Target(), s.Name)
+				if err := f.RevertFactory(); err != nil {
+					output.Error("Unable to revert factory:", f.Target())
+					output.CheckErr(output.Storage, err)
+				}
 			}
 
-			// configure stage factories
-			if s.Name == "0-bootstrap" {
-				fmt.Println("Updating custom role names in custom role factory")
-				roleFactory := fabric.NewRoleFactory(s.Path)
+			for _, f := range factories {
+				if preview != nil {
+					preview.Factories = append(preview.Factories, f.Target())
+					continue
+				}
 
-				s.SetFactory(roleFactory)
-				for _, f := range s.Factories {
-					f.ApplyFactory(prefix)
+				output.Infof("Updating %s factory of %s", f.Target(), s.Name)
+				s.SetFactory(f)
+
+				if err := f.ApplyFactory(prefix); err != nil {
+					output.Error("Unable to update factory:", f.Target())
+					output.CheckErr(output.Storage, err)
 				}
 			}
 
@@ -299,10 +704,100 @@ var configureCmd = &cobra.Command{
 			// ****
 		}
 
-		fmt.Println("\nPasture configure complete! configuration hydrated...")
+		output.Set("prefix", prefix)
+		output.Set("config_file", vars.LocalPath)
+
+		if preview != nil {
+			preview.print()
+			output.Info("\nDry run complete - no changes were made")
+			return
+		}
+
+		output.Info("\nPasture configure complete! configuration hydrated...")
 	},
 }
 
+// stageFactories returns the factories that rewrite the FAST data files
+// of a stage: custom role names and org policies in bootstrap, hierarchical
+// firewall rules in networking and the profile overlay last. Optional
+// factories applied by an earlier run but no longer selected are returned
+// to be reverted.
+func stageFactories(
+	path string,
+	s *fabric.Stage,
+) ([]fabric.FabricFactory, []fabric.FabricFactory, error) {
+	type candidate struct {
+		factory  fabric.FabricFactory
+		selected bool
+	}
+
+	apply := make([]fabric.FabricFactory, 0)
+	revert := make([]fabric.FabricFactory, 0)
+	optional := make([]candidate, 0)
+
+	if s.Type != "foundation" {
+		return apply, revert, nil
+	}
+
+	switch {
+	case s.Name == "0-bootstrap":
+		apply = append(apply, fabric.NewRoleFactory(s.Path))
+
+		f, err := fabric.NewOrgPolicyFactory(s.Path, orgPolicyOverlay)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		optional = append(optional, candidate{f, len(orgPolicyOverlay) > 0})
+	case strings.HasPrefix(s.Name, "2-networking-"):
+		f, err := fabric.NewFirewallFactory(s.Path, firewallOverlay)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		optional = append(optional, candidate{f, len(firewallOverlay) > 0})
+	}
+
+	overlay := fabric.NewOverlayFactory(path, overlayProfile, s)
+	optional = append(optional, candidate{overlay, overlay.Exists()})
+
+	for _, c := range optional {
+		if c.selected {
+			apply = append(apply, c.factory)
+			continue
+		}
+
+		applied, err := c.factory.Applied()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if applied != nil {
+			revert = append(revert, c.factory)
+		}
+	}
+
+	return apply, revert, nil
+}
+
+// checkOverlays rejects firewall overlays when there is no networking
+// stage to apply them to
+func checkOverlays(stages []*fabric.Stage) error {
+	if len(firewallOverlay) == 0 {
+		return nil
+	}
+
+	for _, s := range stages {
+		if strings.HasPrefix(s.Name, "2-networking-") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"--firewall-overlay requires a 2-networking-* stage in --stages",
+	)
+}
+
 func init() {
 	// Add the configure command to the root command
 	RootCmd.AddCommand(configureCmd)
@@ -323,13 +818,48 @@ func init() {
 	configureCmd.Flags().
 		StringVarP(
 			&location,
-			"location", "l", "US", "GCP multi-region location code",
+			"location", "l", "US",
+			"GCP multi-region for BigQuery and GCS (US, EU, ASIA) - "+
+				"BigQuery uses asia-southeast1 for ASIA",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&residency, "residency", "",
+			"Data residency preset (us, eu, asia) setting every location "+
+				"and the default seed region",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&bqLocation, "bq-location", "",
+			"BigQuery multi-region or region, overriding --location",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&gcsLocation, "gcs-location", "",
+			"GCS multi-region, dual-region or region, overriding --location",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&loggingLocation, "logging-location", "",
+			"Log bucket location: global, us, eu or a region",
+		)
+
+	configureCmd.Flags().
+		StringSliceVar(
+			&pubsubLocations, "pubsub-locations", nil,
+			"Regions allowed to store Pub/Sub messages (comma separated)",
 		)
 
 	configureCmd.Flags().
 		StringVar(
 			&fabricVer,
-			"fabric-version", "v32.0.0", "Cloud Foundation Fabric FAST version",
+			"fabric-version", "v32.0.0",
+			"Cloud Foundation Fabric FAST version - --rehydrate defaults to "+
+				"the version of the pasture",
 		)
 
 	configureCmd.Flags().
@@ -368,7 +898,14 @@ func init() {
 	configureCmd.Flags().
 		StringVar(
 			&seedVer, "seed-version", pastureVer,
-			"Version of pasture seed terraform modules to use",
+			"Version of pasture seed terraform modules to use - other "+
+				"versions than the one embedded in pasture are cloned",
+		)
+	configureCmd.Flags().
+		StringVar(
+			&seedPath, "seed-path", "",
+			"Local working tree to link as the seeds instead of a "+
+				"release, for seed development",
 		)
 	configureCmd.Flags().
 		BoolVar(
@@ -376,25 +913,97 @@ func init() {
 			"Limits deployment to FAST foundation only",
 		)
 
-	// One of these flags is required
-	configureCmd.MarkFlagsOneRequired("domain", "rehydrate")
-	configureCmd.MarkFlagsMutuallyExclusive("domain", "rehydrate")
+	configureCmd.Flags().
+		StringSliceVar(
+			&fastFeatures, "features", nil,
+			"Additional FAST resman branches to enable (data_platform, "+
+				"gcve, gke, project_factory, teams) - sandbox is enabled "+
+				"unless --skip-seed is set",
+		)
 
-	// New config flag group
-	configureCmd.MarkFlagsRequiredTogether(
-		"domain",
-		"billing-account",
-		"group-owner",
-	)
+	configureCmd.Flags().
+		StringSliceVar(
+			&fastStageNames, "stages", nil,
+			"Additional FAST stages to deploy after 1-resman ("+
+				strings.Join(fabric.OptionalStages(), ", ")+")",
+		)
+
+	configureCmd.Flags().
+		StringSliceVar(
+			&orgPolicyOverlay, "org-policy-overlay", nil,
+			"Org policies to write over the FAST defaults - preset names ("+
+				strings.Join(fabric.PresetNames(fabric.OrgPolicyPresets), ", ")+
+				") or YAML files",
+		)
+
+	configureCmd.Flags().
+		StringSliceVar(
+			&firewallOverlay, "firewall-overlay", nil,
+			"Hierarchical firewall rules to write over the FAST networking "+
+				"defaults - preset names ("+
+				strings.Join(fabric.PresetNames(fabric.FirewallPresets), ", ")+
+				") or YAML files",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&fabricRepoUrl, "fabric-repo", "",
+			"Git URL or local path of a Cloud Foundation Fabric mirror "+
+				"(default is the GitHub repository)",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&fabricKeyring, "fabric-keyring", "",
+			"File of armored PGP public keys to verify the signature of "+
+				"the FAST tag with",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&seedRepoUrl, "seed-repo", "",
+			"Git URL or local path of a Pastures mirror for the seeds "+
+				"(default is the GitHub repository)",
+		)
+
+	configureCmd.Flags().
+		StringVar(
+			&overlayProfile, "profile", fabric.DefaultProfile,
+			"Profile whose overlay directory under the config path is "+
+				"written over the FAST stage files",
+		)
+
+	configureCmd.Flags().
+		BoolVar(
+			&configUpdate, "update", false,
+			"Update the billing account, locations, features, stages or "+
+				"group owner of an existing configuration",
+		)
+
+	configureCmd.Flags().
+		BoolVar(
+			&configDryRun, "dry-run", false,
+			"Preview the configuration, IAM changes, repositories and "+
+				"symlinks without making any change",
+		)
+
+	// Missing domain, billing account, group owner and prefix flags are
+	// prompted for on a terminal and rejected otherwise
+	configureCmd.MarkFlagsMutuallyExclusive("domain", "rehydrate")
+	configureCmd.MarkFlagsMutuallyExclusive("location", "residency")
 
 	// Internal environment flag group
 	configureCmd.MarkFlagsRequiredTogether("internal", "org-admin-sa")
 	configureCmd.MarkFlagsMutuallyExclusive("rehydrate", "internal")
 
-	// These flags are always required
-	if err := configureCmd.MarkFlagRequired("prefix"); err != nil {
-		cobra.CheckErr(err)
-	}
+	// A local seed working tree replaces a seed release
+	configureCmd.MarkFlagsMutuallyExclusive("seed-path", "seed-version")
+	configureCmd.MarkFlagsMutuallyExclusive("seed-path", "seed-repo")
+
+	// Updates apply to the organization already configured
+	configureCmd.MarkFlagsMutuallyExclusive("update", "rehydrate")
+	configureCmd.MarkFlagsMutuallyExclusive("update", "domain")
+	configureCmd.MarkFlagsMutuallyExclusive("update", "internal")
 
 	// Hide the internal flags
 	if err := configureCmd.Flags().MarkHidden("internal"); err != nil {
@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+func TestRehydratedFastVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		meta    *fabric.ConfigMeta
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "version of the pasture",
+			meta: &fabric.ConfigMeta{FastVersion: "v33.0.0"},
+			want: "v33.0.0",
+		},
+		{
+			name: "config without a version",
+			meta: &fabric.ConfigMeta{},
+			want: "v32.0.0",
+		},
+		{
+			name: "newer version given",
+			args: []string{"--fabric-version", "v34.0.0"},
+			meta: &fabric.ConfigMeta{FastVersion: "v33.0.0"},
+			want: "v34.0.0",
+		},
+		{
+			name:    "older version given",
+			args:    []string{"--fabric-version", "v32.0.0"},
+			meta:    &fabric.ConfigMeta{FastVersion: "v33.0.0"},
+			wantErr: true,
+		},
+	}
+
+	saved := fabricVer
+	t.Cleanup(func() { fabricVer = saved })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &cobra.Command{Use: "pasture"}
+			sub := &cobra.Command{Use: "configure"}
+			sub.Flags().StringVar(&fabricVer, "fabric-version", "v32.0.0", "")
+			root.AddCommand(sub)
+
+			if err := sub.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := rehydratedFastVersion(sub, tt.meta)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("rehydratedFastVersion() = %s, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("rehydratedFastVersion() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphFormat  string
+	graphDestroy bool
+)
+
+type graphStage struct {
+	Name     string   `json:"name" yaml:"name"`
+	Type     string   `json:"type" yaml:"type"`
+	Requires []string `json:"requires,omitempty" yaml:"requires,omitempty"`
+}
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph [SEED]",
+	Short: "Prints the order stages are run in",
+	Long: "Prints the stages of the configured pasture in the waves they " +
+		"are run in. Stages of a wave run concurrently once every stage " +
+		"they require is done, and in reverse order on destroy. The " +
+		"installed seeds are included, or only SEED when one is given.\n\n" +
+		"Use --format dot to render the graph with Graphviz:\n\n\t" +
+		"pasture graph --format dot | dot -Tpng -o pasture.png",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if graphFormat != "text" && graphFormat != "dot" {
+			output.CheckErr(output.Usage, fmt.Errorf(
+				"unsupported graph format %q - must be one of text, dot",
+				graphFormat,
+			))
+		}
+
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.Error("Unable to set configuration path")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		varFile := fabric.LoadVarsFile(path, "")
+		varData := fabric.NewFastConfig()
+
+		if err := varData.ReadConfig(varFile.LocalPath); err != nil {
+			output.Error(
+				"No pasture configured.",
+				"Try running pasture configure",
+			)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		stages := fabric.InitializeFoundationStages(
+			path,
+			varData.Prefix,
+			varData.Stages(),
+			varFile,
+		)
+
+		seeds := args
+		if len(seeds) == 0 {
+			seeds, _ = fabric.InstalledSeeds(path)
+		}
+
+		for _, name := range seeds {
+			seed := fabric.NewSeedStage(path)
+			seed.HydrateSeed(name, varData.Prefix, path)
+			stages = append(stages, seed)
+		}
+
+		graph, err := fabric.NewGraph(stages)
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		order := make([]graphStage, 0)
+		for _, s := range graph.Order(graphDestroy) {
+			order = append(order, graphStage{
+				Name:     s.Name,
+				Type:     s.Type,
+				Requires: s.Requires,
+			})
+		}
+
+		output.Set("order", order)
+
+		if output.Structured() {
+			return
+		}
+
+		if graphFormat == "dot" {
+			fmt.Print(graph.DOT())
+			return
+		}
+
+		fmt.Print(graph.Text(graphDestroy))
+	},
+}
+
+func init() {
+	graphCmd.Flags().
+		StringVar(
+			&graphFormat, "format", "text",
+			"graph format (text, dot)",
+		)
+	graphCmd.Flags().
+		BoolVar(
+			&graphDestroy, "destroy", false,
+			"show the order stages are destroyed in",
+		)
+
+	// Add the graph command to the root command
+	RootCmd.AddCommand(graphCmd)
+}
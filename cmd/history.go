@@ -0,0 +1,160 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyFilter history.Filter
+	historySince  time.Duration
+	historyRemote bool
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Lists previous pasture operations",
+	Long: "Lists the run history recorded by configure, create and destroy. " +
+		"Each record holds the user, flags, stages, duration and result of " +
+		"a run. Use --remote to read the history shared in the outputs " +
+		"bucket, which includes runs from other machines.\n\nExample:\n\n\t" +
+		"pasture history --result failure --since 48h",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var records []history.Record
+		var err error
+
+		if historySince > 0 {
+			historyFilter.Since = time.Now().Add(-historySince)
+		}
+
+		if historyRemote {
+			path, err := utils.ConfigPath()
+			if err != nil {
+				output.CheckErr(output.Preflight, err)
+			}
+
+			varFile := fabric.LoadVarsFile(path, "")
+			varData := fabric.NewFastConfig()
+
+			if err := varData.ReadConfig(varFile.LocalPath); err != nil {
+				output.Error(
+					"Unable to read var file.",
+					"Try running pasture configure --rehydrate",
+				)
+				output.CheckErr(output.Preflight, err)
+			}
+
+			varFile.SetBucket(varData.Prefix)
+
+			records, err = history.ReadRemote(varFile.Bucket, &historyFilter)
+			if err != nil {
+				output.Error("Unable to read run history from bucket")
+				output.CheckErr(output.Storage, err)
+			}
+		} else {
+			records, err = history.Read(&historyFilter)
+			if err != nil {
+				if os.IsNotExist(err) {
+					output.Info("No pasture operations recorded yet")
+					return
+				}
+
+				output.Error("Unable to read run history")
+				output.CheckErr(output.Storage, err)
+			}
+		}
+
+		output.Set("records", records)
+
+		if output.Structured() {
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIMESTAMP\tUSER\tCOMMAND\tSTAGES\tDURATION\tRESULT\tFAST")
+
+		for _, r := range records {
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Timestamp.Local().Format(time.DateTime),
+				r.User,
+				r.Command,
+				strings.Join(r.Stages, ","),
+				time.Duration(r.Duration*float64(time.Second)).Round(time.Second).String(),
+				r.Result,
+				r.FastRef,
+			)
+		}
+
+		w.Flush()
+	},
+}
+
+func init() {
+	// Add the history command to the root command
+	RootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().
+		IntVarP(
+			&historyFilter.Limit,
+			"limit", "n", 20, "Maximum number of records to display",
+		)
+
+	historyCmd.Flags().
+		StringVar(
+			&historyFilter.Command,
+			"command", "", "Only show runs of commands containing this text",
+		)
+
+	historyCmd.Flags().
+		StringVar(
+			&historyFilter.Result,
+			"result", "", "Only show runs with this result (success or failure)",
+		)
+
+	historyCmd.Flags().
+		StringVar(
+			&historyFilter.User,
+			"user", "", "Only show runs by this user email",
+		)
+
+	historyCmd.Flags().
+		DurationVar(
+			&historySince,
+			"since", 0, "Only show runs newer than this duration (e.g. 24h)",
+		)
+
+	historyCmd.Flags().
+		BoolVar(
+			&historyRemote,
+			"remote", false, "Read the run history stored in the outputs bucket",
+		)
+}
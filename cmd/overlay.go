@@ -0,0 +1,175 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var overlayDiffProfile string
+
+type overlayDiff struct {
+	Stage  string `json:"stage" yaml:"stage"`
+	Path   string `json:"path" yaml:"path"`
+	Status string `json:"status" yaml:"status"`
+	Diff   string `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+// overlayCmd represents the overlay command
+var overlayCmd = &cobra.Command{
+	Use:   "overlay",
+	Short: "Inspects the overlay of FAST stage files",
+	Long: "Files under $HOME/.pastures/overlays/<profile>/<stage> are " +
+		"written over the files of the FAST stage by configure, after the " +
+		"checkout is cloned and the other factories have run, so they " +
+		"survive a fresh clone. The top level keys of a YAML mapping are " +
+		"merged into the stage file, and a key set to null is removed. Any " +
+		"other file replaces the stage file or is added to the stage.",
+}
+
+var overlayDiffCmd = &cobra.Command{
+	Use:   "diff [STAGE...]",
+	Short: "Shows how the overlay differs from the upstream FAST files",
+	Long: "Compares each overlay file, merged as configure would, with the " +
+		"stage file in the FAST commit checked out. Only the given stages " +
+		"are compared when any are named.",
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.Error("Unable to set configuration path")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		varFile := fabric.LoadVarsFile(path, "")
+		varData := fabric.NewFastConfig()
+
+		if err := varData.ReadConfig(varFile.LocalPath); err != nil {
+			output.Error(
+				"No pasture configured.",
+				"Try running pasture configure",
+			)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		stages := fabric.InitializeFoundationStages(
+			path,
+			varData.Prefix,
+			varData.Stages(),
+		)
+
+		diffs := make([]overlayDiff, 0)
+
+		for _, s := range stages {
+			if len(args) > 0 && !slices.Contains(args, s.Name) {
+				continue
+			}
+
+			d, err := stageOverlayDiff(path, s)
+			if err != nil {
+				output.Error("Unable to compare overlay of stage:", s.Name)
+				output.CheckErr(output.Storage, err)
+			}
+
+			diffs = append(diffs, d...)
+		}
+
+		output.Set("profile", overlayDiffProfile)
+		output.Set("files", diffs)
+
+		if output.Structured() {
+			return
+		}
+
+		if len(diffs) == 0 {
+			fmt.Println("No overlay files for profile", overlayDiffProfile)
+			return
+		}
+
+		for _, d := range diffs {
+			if d.Diff == "" {
+				fmt.Printf("%s/%s: %s\n", d.Stage, d.Path, d.Status)
+				continue
+			}
+
+			fmt.Print(d.Diff)
+		}
+	},
+}
+
+// stageOverlayDiff compares the overlay files of a stage with upstream
+func stageOverlayDiff(path string, s *fabric.Stage) ([]overlayDiff, error) {
+	diffs := make([]overlayDiff, 0)
+	overlay := fabric.NewOverlayFactory(path, overlayDiffProfile, s)
+
+	files, err := overlay.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range files {
+		d := overlayDiff{Stage: s.Name, Path: rel, Status: "modified"}
+
+		base, err := s.UpstreamFile(rel)
+		if errors.Is(err, fs.ErrNotExist) {
+			d.Status = "added"
+		} else if err != nil {
+			return nil, err
+		}
+
+		merged, err := overlay.Render(rel, base)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Diff = utils.UnifiedDiff(
+			filepath.Join("upstream", s.Name, rel),
+			filepath.Join(overlayDiffProfile, s.Name, rel),
+			base,
+			merged,
+		)
+
+		if d.Diff == "" {
+			d.Status = "unchanged"
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return diffs, nil
+}
+
+func init() {
+	overlayDiffCmd.Flags().
+		StringVar(
+			&overlayDiffProfile, "profile", fabric.DefaultProfile,
+			"Profile whose overlay is compared",
+		)
+
+	overlayCmd.AddCommand(overlayDiffCmd)
+
+	// Add the overlay command to the root command
+	RootCmd.AddCommand(overlayCmd)
+}
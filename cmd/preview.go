@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+)
+
+// configurePreview collects the side effects configure would have
+type configurePreview struct {
+	Directories  []string           `json:"directories"`
+	Downloads    []string           `json:"downloads"`
+	Groups       []string           `json:"groups"`
+	Iam          []google.IamChange `json:"iam"`
+	ConfigFile   string             `json:"config_file"`
+	Config       json.RawMessage    `json:"config,omitempty"`
+	Repositories []repoPreview      `json:"repositories"`
+	Symlinks     []utils.Symlink    `json:"symlinks"`
+	Factories    []string           `json:"factories"`
+}
+
+type repoPreview struct {
+	Url         string `json:"url"`
+	Ref         string `json:"ref"`
+	Destination string `json:"destination"`
+}
+
+func (p *configurePreview) addRepo(r *utils.Repo) {
+	p.Repositories = append(p.Repositories, repoPreview{
+		Url:         r.Url,
+		Ref:         r.Ref,
+		Destination: r.Dst,
+	})
+	p.Symlinks = append(p.Symlinks, r.Link)
+}
+
+// print writes the preview to the console, or attaches it to the result
+// in structured output modes
+func (p *configurePreview) print() {
+	output.Set("dry_run", p)
+
+	if output.Structured() {
+		return
+	}
+
+	printSection("Directories that would be created:", p.Directories)
+	printSection("Files that would be downloaded:", p.Downloads)
+	printSection("Cloud Identity groups that would be created:", p.Groups)
+
+	// an empty delta is still worth reporting
+	if p.Iam != nil {
+		fmt.Println("\nOrganization IAM bindings that would be added:")
+		if len(p.Iam) == 0 {
+			fmt.Println("  (none - all roles are already granted)")
+		}
+		for _, c := range p.Iam {
+			fmt.Printf("  + %s %s\n", c.Role, c.Member)
+		}
+	}
+
+	if p.Config != nil {
+		fmt.Println("\nConfiguration that would be written to", p.ConfigFile+":")
+		fmt.Println(string(p.Config))
+	}
+
+	repos := make([]string, len(p.Repositories))
+	for i, r := range p.Repositories {
+		repos[i] = fmt.Sprintf("%s @ %s -> %s", r.Url, r.Ref, r.Destination)
+	}
+	printSection("Repositories that would be cloned:", repos)
+
+	links := make([]string, len(p.Symlinks))
+	for i, s := range p.Symlinks {
+		links[i] = s.Source + " -> " + s.Target
+	}
+	printSection("Symlinks that would be created:", links)
+
+	printSection("Factory files that would be updated:", p.Factories)
+}
+
+// printSection prints a titled list, skipping empty ones
+func printSection(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Println("\n" + title)
+	for _, i := range items {
+		fmt.Println("  " + i)
+	}
+}
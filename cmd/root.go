@@ -17,16 +17,33 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/diagnose"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile      string
+	verbose      bool
+	outputFormat string
+	logLevel     string
+
+	// top level commands that are recorded in the run history
+	auditedCommands = map[string]bool{
+		"configure": true,
+		"create":    true,
+		"destroy":   true,
+		"upgrade":   true,
+	}
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -37,6 +54,31 @@ var RootCmd = &cobra.Command{
 		"landing zones in your Google Cloud organization. It relies " +
 		"on the Cloud Foundation Fabric framework to establish a GCP " +
 		"foundation, and it will deploy each 'pasture' as a Sandbox project.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		settingsErr := applySettings(cmd)
+
+		if err := output.SetFormat(outputFormat); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		if err := logging.SetLevel(logLevel); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		output.Begin(cmd.CommandPath())
+
+		if settingsErr != nil {
+			output.CheckErr(output.Usage, settingsErr)
+		}
+
+		if auditedCommands[topLevelName(cmd)] && !dryRun(cmd) {
+			history.Start(cmd.CommandPath(), changedFlags(cmd))
+			startRunLog(cmd)
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		output.Done()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -44,13 +86,25 @@ var RootCmd = &cobra.Command{
 func Execute() {
 	err := RootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		// cobra has already printed the usage error in text mode
+		if output.SetFormat(outputFormat) != nil || !output.Structured() {
+			os.Exit(output.ExitCode(output.Usage))
+		}
+
+		output.Begin(RootCmd.Name())
+		output.CheckErr(output.Usage, err)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	// Persist the run history and logs whenever a command reports its outcome
+	output.OnExit(history.Finish)
+	output.OnExit(explainFailure)
+	output.OnExit(closeRunLog)
+	output.OnEvent(logEvent)
+
 	// Lets hide the pesky completion flag
 	RootCmd.CompletionOptions.HiddenDefaultCmd = true
 
@@ -61,20 +115,37 @@ func init() {
 	RootCmd.PersistentFlags().
 		StringVar(
 			&cfgFile, "config", "",
-			"config file (default is $HOME/.pastures.yaml)",
+			"file with flag defaults (default is $HOME/.pastures.yaml "+
+				"or $PASTURES_CONFIG)",
 		)
 	RootCmd.PersistentFlags().
 		BoolVar(
 			&verbose, "verbose", false, "controls Terraform output verbosity",
 		)
+	RootCmd.PersistentFlags().
+		StringVarP(
+			&outputFormat, "output", "o", output.FormatText,
+			"output format for progress events and results (text, json, yaml)",
+		)
+	RootCmd.PersistentFlags().
+		StringVar(
+			&logLevel, "log-level", "warn",
+			"console log level (debug, info, warn, error) - "+
+				"run logs are always kept under the config path",
+		)
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig reads in config file and ENV variables if set. Flags are
+// filled from them in applySettings.
 func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv(envPrefix + "_CONFIG")
+	}
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -89,10 +160,122 @@ func initConfig() {
 		viper.SetConfigName(".pastures")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// If a config file is found, read it in. A file named explicitly
+	// must exist, and any file found must parse.
+	var notFound viper.ConfigFileNotFoundError
+
+	err := viper.ReadInConfig()
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	switch {
+	case err == nil:
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	case cfgFile == "" && errors.As(err, &notFound):
+		// no defaults file
+	default:
+		fmt.Fprintln(os.Stderr, "Unable to read config file:", err)
+		os.Exit(output.ExitCode(output.Usage))
+	}
+}
+
+// topLevelName returns the name of the command directly beneath root
+func topLevelName(cmd *cobra.Command) string {
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		if !c.Parent().HasParent() {
+			return c.Name()
+		}
+	}
+
+	return ""
+}
+
+// dryRun reports whether the run is a configure --dry-run, which
+// makes no change and so leaves no history record or run log
+func dryRun(cmd *cobra.Command) bool {
+	if topLevelName(cmd) != "configure" {
+		return false
+	}
+
+	dry, err := cmd.Flags().GetBool("dry-run")
+
+	return err == nil && dry
+}
+
+func changedFlags(cmd *cobra.Command) map[string]string {
+	flags := make(map[string]string)
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	return flags
+}
+
+// startRunLog opens the per-run log directory that captures every log
+// record and the full terraform output of each stage
+func startRunLog(cmd *cobra.Command) {
+	path, err := utils.ConfigPath()
+	if err != nil {
+		return
+	}
+
+	if err := logging.Start(path, cmd.CommandPath()); err != nil {
+		output.Warn("Unable to create run log directory:", err)
+		return
+	}
+
+	logging.Info("starting run", "command", cmd.CommandPath(), "version", pastureVer)
+}
+
+func closeRunLog(err error) {
+	if dir := logging.Dir(); dir != "" {
+		if err != nil {
+			logging.Error("run failed", "error", err)
+			output.Info("Logs for this run are available at:", dir)
+		}
+
+		logging.Close()
+	}
+}
+
+// explainFailure prints remediation hints for errors that match a known
+// failure, such as a disabled API or a missing permission
+func explainFailure(err error) {
+	if err == nil {
+		return
 	}
+
+	path, pathErr := utils.ConfigPath()
+	if pathErr != nil {
+		return
+	}
+
+	rules, rulesErr := diagnose.LoadRules(path)
+	if rulesErr != nil {
+		output.Warn("Unable to load diagnostic rules:", rulesErr)
+		return
+	}
+
+	matches := rules.Diagnose(err)
+	if len(matches) == 0 {
+		return
+	}
+
+	for _, m := range matches {
+		output.Info("\nHint:", m.Hint)
+
+		if m.Docs != "" {
+			output.Info("Docs:", m.Docs)
+		}
+	}
+
+	output.Set("hints", matches)
+}
+
+func logEvent(e *output.Event) {
+	if e.Stage != "" {
+		logging.Event(e.Level, e.Message, "stage", e.Stage)
+		return
+	}
+
+	logging.Event(e.Level, e.Message)
 }
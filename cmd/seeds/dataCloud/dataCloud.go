@@ -17,23 +17,27 @@ limitations under the License.
 package dataCloud
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/terraform"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
-	dryRun     bool
-	skipFast   bool
-	region     string
-	size       string
-	verbose    bool
-	isInternal bool
+	dryRun       bool
+	skipFast     bool
+	region       string
+	size         string
+	verbose      bool
+	isInternal   bool
+	ignoreCompat bool
 )
 
 // Set up pointers to support multiple distinct parents
@@ -64,13 +68,25 @@ var DataCloudCmd = &cobra.Command{
 		// Hydrate the configuration
 		varFile, varData := hydrateConfig(configPath)
 
+		// Keep the seed inside the configured data residency
+		resolveRegion(cmd, varData)
+
 		// Load foundation stages
 		stages := fabric.InitializeFoundationStages(
 			configPath,
 			varData.Prefix,
+			varData.Stages(),
 			varFile,
 		)
 
+		if ref, err := stages[0].Repository.Describe(); err == nil {
+			history.SetFastRef(ref)
+		}
+
+		if cmd.Parent().Name() == "create" {
+			checkCompatibility(varData, stages[0])
+		}
+
 		// Seed stage
 		seed := fabric.NewSeedStage(configPath)
 		seed.HydrateSeed(cmd.Use, varData.Prefix, configPath)
@@ -80,7 +96,7 @@ var DataCloudCmd = &cobra.Command{
 		stages = append(stages, seed)
 
 		// Execute the stages
-		processStages(cmd, stages, varFile)
+		processStages(cmd, stages)
 	},
 }
 
@@ -89,31 +105,122 @@ func hydrateConfig(configPath string) (*fabric.VarsFile, *fabric.FastConfig) {
 	varData := fabric.NewFastConfig()
 
 	if err := varData.ReadConfig(varsFile.LocalPath); err != nil {
-		fmt.Println(
+		output.Error(
 			"Unable to read var file. Try running pasture configure --rehydrate",
 		)
-		cobra.CheckErr(err)
+		output.CheckErr(output.Preflight, err)
+	}
+
+	// terraform reads the file, so it needs the migrated variables
+	if _, err := varData.MigrateConfig(varsFile.LocalPath); err != nil {
+		output.Error("Unable to save the migrated configuration")
+		output.CheckErr(output.Storage, err)
 	}
 
 	varsFile.AddConfig(varData)
 	varsFile.SetBucket(
 		varData.Prefix,
 	) // TODO: this can be optimized by splitting deps and stage vars
+	history.SetBucket(varsFile.Bucket)
 
 	return varsFile, varData
 }
 
+// checkCompatibility refuses to create the seed in a foundation of a FAST
+// release it does not work with, and warns when that is not known
+func checkCompatibility(varData *fabric.FastConfig, foundation *fabric.Stage) {
+	var fast, seed string
+
+	if meta := varData.Meta; meta != nil {
+		if meta.SeedPath != "" {
+			output.Warn(
+				"The seeds are linked from " + meta.SeedPath + ", so their " +
+					"compatibility with FAST is not checked",
+			)
+			return
+		}
+
+		fast, seed = meta.FastVersion, meta.SeedVersion
+	}
+
+	if fast == "" {
+		fast, _ = foundation.Repository.Describe()
+	}
+
+	if fast == "" || seed == "" {
+		output.Warn(
+			"The FAST and seed versions of this pasture are not recorded, " +
+				"so their compatibility is not checked",
+		)
+		return
+	}
+
+	err := fabric.CheckCompatibility(fast, seed)
+
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, fabric.ErrUnknownCompatibility), ignoreCompat:
+		output.Warn(err.Error())
+		return
+	}
+
+	hint := "Reconfigure with pasture configure"
+	if v := fabric.SuggestFastVersion(seed); v != "" {
+		hint += " --fabric-version " + v
+	}
+
+	if seeds := fabric.SeedVersionsFor(fast); len(seeds) > 0 {
+		hint += " or --seed-version " + seeds[len(seeds)-1]
+	}
+
+	output.Error(hint + ", or pass --ignore-compatibility")
+	output.CheckErr(output.Preflight, err)
+}
+
+func resolveRegion(cmd *cobra.Command, varData *fabric.FastConfig) {
+	meta := varData.Meta
+
+	if !cmd.Flags().Changed("region") && meta != nil && meta.Region != "" {
+		region = meta.Region
+	}
+
+	if err := fabric.ValidateRegion(region); err != nil {
+		output.CheckErr(output.Usage, err)
+	}
+
+	if meta == nil || meta.Residency == "" {
+		return
+	}
+
+	res, err := fabric.GetResidency(meta.Residency)
+	if err != nil {
+		output.CheckErr(output.Preflight, err)
+	}
+
+	if !res.AllowsRegion(region) {
+		output.CheckErr(output.Usage, fmt.Errorf(
+			"region %s is outside the %s data residency of this pasture",
+			region,
+			res.Name,
+		))
+	}
+}
+
 func checkGoogleADCValidity() {
-	if _, err := google.AppDefaultCredentials(); err != nil {
-		cobra.CheckErr(err)
+	email, err := google.AppDefaultCredentials()
+	if err != nil {
+		output.CheckErr(output.Auth, err)
 	}
+
+	history.SetUser(email)
 }
 
 func getConfigPath() string {
 	configPath, err := utils.ConfigPath()
 	if err != nil {
-		fmt.Println("Unable to set configuration path")
-		cobra.CheckErr(err)
+		output.Error("Unable to set configuration path")
+		output.CheckErr(output.Preflight, err)
 	}
 
 	return configPath
@@ -126,66 +233,86 @@ func setPersistentFlagsFromParent(cmd *cobra.Command) {
 	isInternal, _ = cmd.Flags().GetBool("internal")
 }
 
-func processStages(
-	cmd *cobra.Command,
-	stages []*fabric.Stage,
-	varFile *fabric.VarsFile,
-) {
-	// Loop through the ordered collection of
-	// FAST foundation and seed stages
-	for _, s := range stages {
-
-		// Get seed template parameters
-		seedVars := getSeedVars(s)
-
-		// Skip over foundation stages if destroying a pasture
-		// or the `skipFast` flag has been set
-		if shouldSkipStage(cmd, s) {
-			continue
-		}
+func processStages(cmd *cobra.Command, stages []*fabric.Stage) {
+	destroy := cmd.Parent().Name() == "destroy"
+
+	graph, err := fabric.NewGraph(stages)
+	if err != nil {
+		output.CheckErr(output.General, err)
+	}
 
-		// Smoke test if FAST can be deployed to the current org
-		if dryRun && s.Name == "0-bootstrap" {
+	// Smoke test if FAST can be deployed to the current org
+	if dryRun && !destroy && !skipFast {
+		for _, s := range graph.Roots() {
 			handleDryRun(s)
-			break // exit the loop early
 		}
 
-		// Determine if we've run Pastures on this terminal before
-		firstRun := handleFirstRun(s)
+		return
+	}
 
-		// Initialize the stage
-		fmt.Println("Initializing", s.Name)
-		if err := s.Init(verbose); err != nil {
-			fmt.Println("Failed to migrate state to remote backend")
-			cobra.CheckErr(err)
+	// Run the FAST foundation and seed stages once their prerequisites
+	// are done, or in reverse when destroying
+	err = graph.Run(destroy, func(s *fabric.Stage) error {
+		return runStage(cmd, s)
+	})
+	if err != nil {
+		output.CheckErr(output.CategoryOf(err), err)
+	}
+}
+
+func runStage(cmd *cobra.Command, s *fabric.Stage) error {
+	// Get seed template parameters
+	seedVars := getSeedVars(s)
+
+	// Skip over foundation stages if destroying a pasture
+	// or the `skipFast` flag has been set
+	if shouldSkipStage(cmd, s) {
+		return nil
+	}
+
+	history.AddStage(s.Name)
+
+	// Determine if we've run Pastures on this terminal before
+	firstRun := handleFirstRun(s)
+
+	// Initialize the stage
+	output.Stage(s.Name, "Initializing", s.Name)
+	if err := s.Init(verbose); err != nil {
+		output.Error("Failed to migrate state to remote backend")
+		return output.Fail(output.Terraform, err)
+	}
+	output.Info("Configuration complete")
+
+	// Begin stage execution
+	if cmd.Parent().Name() == "destroy" {
+		output.Stage(s.Name, "Destroying stage:", s.Name)
+		if err := destroyStage(s, seedVars); err != nil {
+			return err
 		}
-		fmt.Println("Configuration complete")
-
-		// Begin stage execution
-		if cmd.Parent().Name() == "destroy" {
-			fmt.Println("Destroying stage:", s.Name)
-			destroyStage(s, seedVars)
-		} else {
-			fmt.Println("Deploying stage:", s.Name)
-			applyStage(s, seedVars, varFile, firstRun)
+	} else {
+		output.Stage(s.Name, "Deploying stage:", s.Name)
+		if err := applyStage(s, seedVars, firstRun); err != nil {
+			return err
 		}
+	}
 
-		fmt.Println("Stage complete:", s.Name)
+	output.Stage(s.Name, "Stage complete:", s.Name)
 
-		if s.Type == "seed" && cmd.Parent().Name() == "create" {
-			handleSeedStage(s)
-		}
+	if s.Type == "seed" && cmd.Parent().Name() == "create" {
+		handleSeedStage(s)
 	}
+
+	return nil
 }
 
 func shouldSkipStage(cmd *cobra.Command, s *fabric.Stage) bool {
 	if cmd.Parent().Name() == "destroy" && s.Type == "foundation" {
-		fmt.Println("Skipping foundation stage:", s.Name)
+		output.Stage(s.Name, "Skipping foundation stage:", s.Name)
 		return true
 	}
 
 	if skipFast && s.Type == "foundation" {
-		fmt.Println("Skipping foundation stage:", s.Name)
+		output.Stage(s.Name, "Skipping foundation stage:", s.Name)
 		return true
 	}
 
@@ -193,19 +320,19 @@ func shouldSkipStage(cmd *cobra.Command, s *fabric.Stage) bool {
 }
 
 func handleDryRun(s *fabric.Stage) {
-	fmt.Println("Testing if foundation can be applied to GCP organization")
+	output.Info("Testing if foundation can be applied to GCP organization")
 
 	if err := s.Init(verbose); err != nil {
-		fmt.Println("Cannot initialize stage for dry run")
-		cobra.CheckErr(err)
+		output.Error("Cannot initialize stage for dry run")
+		output.CheckErr(output.Terraform, err)
 	}
 
 	if err := s.Plan(verbose); err != nil {
-		fmt.Println("Foundation cannot be applied to GCP organization")
-		cobra.CheckErr(err)
+		output.Error("Foundation cannot be applied to GCP organization")
+		output.CheckErr(output.Terraform, err)
 	}
 
-	fmt.Println("Foundation can be applied to GCP organization")
+	output.Info("Foundation can be applied to GCP organization")
 }
 
 func getSeedVars(s *fabric.Stage) []*terraform.Vars {
@@ -239,61 +366,65 @@ func getSeedVars(s *fabric.Stage) []*terraform.Vars {
 
 func handleFirstRun(s *fabric.Stage) bool {
 	if err := s.DiscoverFiles(); err != nil {
-		fmt.Println("Pastures first run detected - running with local state")
+		output.Info("Pastures first run detected - running with local state")
 		return true
 	}
 	return false
 }
 
-func destroyStage(s *fabric.Stage, seedVars []*terraform.Vars) {
-	fmt.Println("Starting destroy:", s.Name)
+func destroyStage(s *fabric.Stage, seedVars []*terraform.Vars) error {
+	output.Stage(s.Name, "Starting destroy:", s.Name)
 	if err := s.Destroy(seedVars, verbose); err != nil {
-		fmt.Println("Stage failed to destroy:", s.Name)
-		cobra.CheckErr(err)
+		output.Error("Stage failed to destroy:", s.Name)
+		return output.Fail(output.Terraform, err)
 	}
-	fmt.Println("Successfully destroyed stage:", s.Name)
+	output.Stage(s.Name, "Successfully destroyed stage:", s.Name)
+
+	return nil
 }
 
 func applyStage(
 	s *fabric.Stage,
 	seedVars []*terraform.Vars,
-	varFile *fabric.VarsFile,
 	firstRun bool,
-) {
-	fmt.Println("Starting apply:", s.Name)
+) error {
+	output.Stage(s.Name, "Starting apply:", s.Name)
 	if err := s.Apply(seedVars, verbose); err != nil {
-		fmt.Println("Stage failed to deploy:", s.Name)
-		cobra.CheckErr(err)
+		output.Error("Stage failed to deploy:", s.Name)
+		return output.Fail(output.Terraform, err)
 	}
-	fmt.Println("Successfully applied stage:", s.Name)
+	output.Stage(s.Name, "Successfully applied stage:", s.Name)
 
-	if s.Name == "0-bootstrap" {
-		fmt.Println("Uploading pasture vars to GCS bucket")
-		if err := varFile.UploadFile(); err != nil {
-			fmt.Println("Failed to upload pasture var file")
-			cobra.CheckErr(err)
+	if len(s.Uploads) > 0 {
+		output.Info("Uploading pasture vars to GCS bucket")
+		if err := s.UploadOutputs(); err != nil {
+			output.Error("Failed to upload pasture var file")
+			return output.Fail(output.Storage, err)
 		}
 	}
 
 	if firstRun {
 		if err := s.DiscoverFiles(); err != nil {
-			fmt.Println("Unable to retrieve stage dependencies for:", s.Name)
-			cobra.CheckErr(err)
+			output.Error("Unable to retrieve stage dependencies for:", s.Name)
+			return output.Fail(output.Storage, err)
 		}
 
 		if err := s.Init(verbose); err != nil {
-			fmt.Println("Failed to migrate state to remote backend")
-			cobra.CheckErr(err)
+			output.Error("Failed to migrate state to remote backend")
+			return output.Fail(output.Terraform, err)
 		}
 	}
+
+	return nil
 }
 
 func handleSeedStage(s *fabric.Stage) {
 	ep, err := terraform.TfOutput(s.Path, "datafusion_endpoint", verbose)
 	if err != nil {
-		fmt.Println("Stage complete:", s.Name)
+		output.Stage(s.Name, "Stage complete:", s.Name)
 	}
-	fmt.Println(
+	output.Set("datafusion_endpoint", ep)
+	output.Info(
 		"Navigate to your Data Fusion endpoint to begin data "+
 			"ingestion and integration:",
 		ep,
@@ -305,19 +436,27 @@ func init() {
 	DataCloudCreate.Flags().
 		StringVarP(
 			&region, "region", "r", "us-central1",
-			"Region for GCP resources to be deployed",
+			"Region for GCP resources to be deployed "+
+				"(defaults to the region of the configured residency)",
 		)
 	DataCloudCreate.Flags().
 		StringVarP(
 			&size, "pasture-size", "s", "",
 			"Size of pasture environment - must be 'big' or 'small'",
 		)
+	DataCloudCreate.Flags().
+		BoolVar(
+			&ignoreCompat, "ignore-compatibility", false,
+			"Create the seed even if it does not work with the FAST "+
+				"version of the foundation",
+		)
 
 	// TODO: is there a better way to do this in Cobra?
 	DataCloudDestroy.Flags().
 		StringVarP(
 			&region, "region", "r", "us-central1",
-			"Region for GCP resources to be deployed",
+			"Region for GCP resources to be deployed "+
+				"(defaults to the region of the configured residency)",
 		)
 	DataCloudDestroy.Flags().
 		StringVarP(&size, "pasture-size", "s", "",
@@ -325,10 +464,6 @@ func init() {
 		)
 
 	// Required flags
-	if err := DataCloudCreate.MarkFlagRequired("region"); err != nil {
-		cobra.CheckErr(err)
-	}
-
 	if err := DataCloudDestroy.MarkFlagRequired("pasture-size"); err != nil {
 		cobra.CheckErr(err)
 	}
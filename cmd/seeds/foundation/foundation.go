@@ -17,10 +17,10 @@ limitations under the License.
 package foundation
 
 import (
-	"fmt"
-
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -49,15 +49,18 @@ var FoundationCmd = &cobra.Command{
 		// Construct path for the config
 		p, err := utils.ConfigPath()
 		if err != nil {
-			fmt.Println("Unable to set configuration path")
-			cobra.CheckErr(err)
+			output.Error("Unable to set configuration path")
+			output.CheckErr(output.Preflight, err)
 		}
 
 		// Check if Google ADC is valid
-		if _, err := google.AppDefaultCredentials(); err != nil {
-			cobra.CheckErr(err)
+		email, err := google.AppDefaultCredentials()
+		if err != nil {
+			output.CheckErr(output.Auth, err)
 		}
 
+		history.SetUser(email)
+
 		// Get persistent flags from parent
 		dryRun, _ = cmd.Flags().GetBool("dry-run")
 		verbose, _ = cmd.Flags().GetBool("verbose")
@@ -67,133 +70,150 @@ var FoundationCmd = &cobra.Command{
 		varData := fabric.NewFastConfig()
 
 		if err := varData.ReadConfig(varFile.LocalPath); err != nil {
-			fmt.Println(
+			output.Error(
 				"Unable to read var file.",
 				"Try running pasture configure --rehydrate",
 			)
-			cobra.CheckErr(err)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		// terraform reads the file, so it needs the migrated variables
+		if _, err := varData.MigrateConfig(varFile.LocalPath); err != nil {
+			output.Error("Unable to save the migrated configuration")
+			output.CheckErr(output.Storage, err)
 		}
 
 		varFile.AddConfig(varData)
 		varFile.SetBucket(
 			varData.Prefix,
 		) // TODO: this can be optimized by splitting deps and stage vars
+		history.SetBucket(varFile.Bucket)
 
 		// Load foundation stages
-		stages := fabric.InitializeFoundationStages(p, varData.Prefix, varFile)
+		stages := fabric.InitializeFoundationStages(
+			p,
+			varData.Prefix,
+			varData.Stages(),
+			varFile,
+		)
 
-		// Do things with the stages
-		for _, s := range stages {
-			var firstRun bool = false
+		if ref, err := stages[0].Repository.Describe(); err == nil {
+			history.SetFastRef(ref)
+		}
 
-			// destroy not supported for foundation stage
-			if cmd.Parent().Name() == "destroy" && s.Type == "foundation" {
-				fmt.Println("Skipping foundation stage:", s.Name)
-				continue
-			}
+		destroy := cmd.Parent().Name() == "destroy"
 
-			// dry run bootstrap stage
-			if dryRun && s.Name == "0-bootstrap" {
-				fmt.Println(
-					"Testing if foundation can be applied to GCP organization",
-				)
+		graph, err := fabric.NewGraph(stages)
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		// dry run the stages without prerequisites
+		if dryRun && !destroy {
+			output.Info(
+				"Testing if foundation can be applied to GCP organization",
+			)
 
+			for _, s := range graph.Roots() {
 				if err := s.Init(verbose); err != nil {
-					fmt.Println("Cannot initialize stage for dry run")
-					cobra.CheckErr(err)
+					output.Error("Cannot initialize stage for dry run")
+					output.CheckErr(output.Terraform, err)
 				}
 
 				if err := s.Plan(verbose); err != nil {
-					fmt.Println(
+					output.Error(
 						"Foundation cannot be applied to GCP organization",
 					)
-					cobra.CheckErr(err)
+					output.CheckErr(output.Terraform, err)
 				}
-
-				fmt.Println("Foundation can be applied to GCP organization")
-				break // Don't do anything else
 			}
 
-			// do what we came here to do
-			if cmd.Parent().Name() == "destroy" {
-				fmt.Println("Destroying stage:", s.Name)
-			} else {
-				fmt.Println("Deploying stage:", s.Name)
-			}
+			output.Info("Foundation can be applied to GCP organization")
+			return
+		}
 
-			// try fetching dependency files
-			if err := s.DiscoverFiles(); err != nil {
-				fmt.Println(
-					"Pastures first run detected - running with local state",
-				)
-				firstRun = true
+		// Do things with the stages
+		err = graph.Run(destroy, func(s *fabric.Stage) error {
+			// destroy not supported for foundation stage
+			if destroy {
+				output.Stage(s.Name, "Skipping foundation stage:", s.Name)
+				return nil
 			}
 
-			// check if state needs to be migrated
-			fmt.Println("Initializing", s.Name)
-			if err := s.Init(verbose); err != nil {
-				fmt.Println("Failed to migrate state to remote backend")
-				cobra.CheckErr(err)
-			}
+			return applyStage(s)
+		})
+		if err != nil {
+			output.CheckErr(output.CategoryOf(err), err)
+		}
 
-			fmt.Println("Configuration complete")
+		output.Info(
+			"Navigate to the Google Cloud Console to deploy your first workload:",
+			"https://console.cloud.google.com/welcome",
+		)
+	},
+}
 
-			if cmd.Parent().Name() == "destroy" {
-				// destroy the stage
-				fmt.Println("Starting destroy:", s.Name)
-				if err := s.Destroy(nil, verbose); err != nil {
-					fmt.Println("Stage failed to destroy:", s.Name)
-					cobra.CheckErr(err)
-				}
+// applyStage deploys a foundation stage, moving its state to the outputs
+// bucket on the first run
+func applyStage(s *fabric.Stage) error {
+	var firstRun bool = false
 
-				fmt.Println("Successfully destroyed stage:", s.Name)
-			} else {
-				// apply stage
-				fmt.Println("Starting apply:", s.Name)
-				if err := s.Apply(nil, verbose); err != nil {
-					fmt.Println("Stage failed to deploy:", s.Name)
-					cobra.CheckErr(err)
-				}
+	history.AddStage(s.Name)
 
-				fmt.Println("Successfully applied stage:", s.Name)
+	output.Stage(s.Name, "Deploying stage:", s.Name)
 
-				// move pasture vars to bucket
-				if s.Name == "0-bootstrap" {
-					fmt.Println("Uploading pasture vars to GCS bucket")
+	// try fetching dependency files
+	if err := s.DiscoverFiles(); err != nil {
+		output.Info("Pastures first run detected - running with local state")
+		firstRun = true
+	}
 
-					if err := varFile.UploadFile(); err != nil {
-						fmt.Println("Failed to upload pasture var file")
-						cobra.CheckErr(err)
-					}
-				}
+	// check if state needs to be migrated
+	output.Stage(s.Name, "Initializing", s.Name)
+	if err := s.Init(verbose); err != nil {
+		output.Error("Failed to migrate state to remote backend")
+		return output.Fail(output.Terraform, err)
+	}
 
-				// first run was detected - move things to cloud
-				if firstRun {
-					// try fetching dependency files
-					if err := s.DiscoverFiles(); err != nil {
-						fmt.Println(
-							"Unable to retrieve stage dependencies for:",
-							s.Name,
-						)
-						cobra.CheckErr(err)
-					}
-
-					// migrate the state
-					if err := s.Init(verbose); err != nil {
-						fmt.Println("Failed to migrate state to remote backend")
-						cobra.CheckErr(err)
-					}
-				}
-			}
+	output.Info("Configuration complete")
 
-			fmt.Println("Stage complete:", s.Name)
+	// apply stage
+	output.Stage(s.Name, "Starting apply:", s.Name)
+	if err := s.Apply(nil, verbose); err != nil {
+		output.Error("Stage failed to deploy:", s.Name)
+		return output.Fail(output.Terraform, err)
+	}
+
+	output.Stage(s.Name, "Successfully applied stage:", s.Name)
+
+	// move pasture vars to bucket
+	if len(s.Uploads) > 0 {
+		output.Info("Uploading pasture vars to GCS bucket")
+
+		if err := s.UploadOutputs(); err != nil {
+			output.Error("Failed to upload pasture var file")
+			return output.Fail(output.Storage, err)
+		}
+	}
+
+	// first run was detected - move things to cloud
+	if firstRun {
+		// try fetching dependency files
+		if err := s.DiscoverFiles(); err != nil {
+			output.Error("Unable to retrieve stage dependencies for:", s.Name)
+			return output.Fail(output.Storage, err)
 		}
 
-		fmt.Println(
-			"Navigate to the Google Cloud Console to deploy your first workload:",
-			"https://console.cloud.google.com/welcome",
-		)
-	},
+		// migrate the state
+		if err := s.Init(verbose); err != nil {
+			output.Error("Failed to migrate state to remote backend")
+			return output.Fail(output.Terraform, err)
+		}
+	}
+
+	output.Stage(s.Name, "Stage complete:", s.Name)
+
+	return nil
 }
 
 func init() {}
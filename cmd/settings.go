@@ -0,0 +1,223 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	envPrefix = "PASTURES"
+
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+
+	// cobra keeps flag groups in these annotations
+	mutuallyExclusiveAnnotation = "cobra_annotation_mutually_exclusive"
+)
+
+var (
+	// flags that are never read from the environment or config file
+	unboundFlags = map[string]bool{
+		"config": true,
+		"help":   true,
+	}
+
+	// flags filled by applySettings rather than the command line
+	appliedFlags = make(map[*pflag.Flag]bool)
+)
+
+type setting struct {
+	Command string `json:"command" yaml:"command"`
+	Flag    string `json:"flag" yaml:"flag"`
+	Key     string `json:"key" yaml:"key"`
+	Env     string `json:"env" yaml:"env"`
+	Value   string `json:"value" yaml:"value"`
+	Source  string `json:"source" yaml:"source"`
+}
+
+// applySettings fills every flag not given on the command line from a
+// PASTURES_* environment variable or the config file, in that order.
+// Keys are the command path and flag name, e.g. create.data-cloud.region,
+// and the most specific key wins; a bare flag name applies to every
+// command with that flag.
+func applySettings(cmd *cobra.Command) error {
+	var errs []error
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || unboundFlags[f.Name] || excludedByFlag(cmd, f) {
+			return
+		}
+
+		s := resolveSetting(cmd, f)
+		if s.Source == sourceDefault {
+			return
+		}
+
+		if err := setFlag(f, s); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		// required flag checks treat the flag as set
+		f.Changed = true
+		appliedFlags[f] = true
+	})
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// explicitlySet reports whether a flag was given on the command line,
+// rather than filled from the environment or the config file
+func explicitlySet(cmd *cobra.Command, name string) bool {
+	f := cmd.Flags().Lookup(name)
+
+	return f != nil && f.Changed && !appliedFlags[f]
+}
+
+// resolveSetting finds the effective value of a flag and where it came from
+func resolveSetting(cmd *cobra.Command, f *pflag.Flag) setting {
+	keys := settingKeys(cmd, f.Name)
+
+	s := setting{
+		Command: cmd.CommandPath(),
+		Flag:    f.Name,
+		Key:     keys[0],
+		Env:     envName(keys[0]),
+		Value:   f.Value.String(),
+		Source:  sourceDefault,
+	}
+
+	if f.Changed && !appliedFlags[f] {
+		s.Source = sourceFlag
+		return s
+	}
+
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(envName(k)); ok {
+			s.Key, s.Env, s.Value, s.Source = k, envName(k), v, sourceEnv
+			return s
+		}
+	}
+
+	for _, k := range keys {
+		if viper.InConfig(k) {
+			s.Key, s.Env, s.Source = k, envName(k), sourceFile
+			s.Value = strings.Join(viper.GetStringSlice(k), ",")
+
+			if _, ok := f.Value.(pflag.SliceValue); !ok {
+				s.Value = viper.GetString(k)
+			}
+
+			return s
+		}
+	}
+
+	return s
+}
+
+// settingKeys lists the config keys for a flag, most specific first
+func settingKeys(cmd *cobra.Command, name string) []string {
+	var keys []string
+
+	for c := cmd; c != nil; c = c.Parent() {
+		path := strings.TrimPrefix(c.CommandPath(), c.Root().Name())
+		path = strings.ReplaceAll(strings.TrimSpace(path), " ", ".")
+
+		if path == "" {
+			keys = append(keys, name)
+		} else {
+			keys = append(keys, path+"."+name)
+		}
+	}
+
+	return keys
+}
+
+func envName(key string) string {
+	r := strings.NewReplacer(".", "_", "-", "_")
+	return envPrefix + "_" + strings.ToUpper(r.Replace(key))
+}
+
+func setFlag(f *pflag.Flag, s setting) error {
+	var err error
+
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		err = sv.Replace(strings.Split(s.Value, ","))
+	} else {
+		err = f.Value.Set(s.Value)
+	}
+
+	if err != nil {
+		from := s.Env
+		if s.Source == sourceFile {
+			from = s.Key + " in " + viper.ConfigFileUsed()
+		}
+
+		return fmt.Errorf("invalid value for --%s from %s: %w", f.Name, from, err)
+	}
+
+	return nil
+}
+
+// excludedByFlag reports whether a flag is mutually exclusive with one
+// given on the command line, so a default must not conflict with it
+func excludedByFlag(cmd *cobra.Command, f *pflag.Flag) bool {
+	for _, group := range f.Annotations[mutuallyExclusiveAnnotation] {
+		for _, name := range strings.Fields(group) {
+			if o := cmd.Flags().Lookup(name); o != nil && o != f && o.Changed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// commandSettings resolves every bindable flag of a command tree
+func commandSettings(cmd *cobra.Command) []setting {
+	var settings []setting
+
+	// inherited flags are listed once, on the command defining them
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || unboundFlags[f.Name] {
+			return
+		}
+
+		settings = append(settings, resolveSetting(cmd, f))
+	})
+
+	for _, c := range cmd.Commands() {
+		if c.IsAvailableCommand() {
+			settings = append(settings, commandSettings(c)...)
+		}
+	}
+
+	return settings
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// testCommand returns the configure command of a fresh tree with a prefix
+// flag, parsed from args
+func testCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+
+	root := &cobra.Command{Use: "pasture"}
+	sub := &cobra.Command{Use: "configure"}
+	sub.Flags().String("prefix", "default", "")
+	root.AddCommand(sub)
+
+	if err := sub.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return sub
+}
+
+func TestResolveSetting(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		file       string
+		wantValue  string
+		wantSource string
+		wantKey    string
+	}{
+		{
+			name:       "default",
+			wantValue:  "default",
+			wantSource: sourceDefault,
+			wantKey:    "configure.prefix",
+		},
+		{
+			name:       "bare key in file",
+			file:       "prefix: bare\n",
+			wantValue:  "bare",
+			wantSource: sourceFile,
+			wantKey:    "prefix",
+		},
+		{
+			name:       "command key in file wins over bare key",
+			file:       "prefix: bare\nconfigure:\n  prefix: file\n",
+			wantValue:  "file",
+			wantSource: sourceFile,
+			wantKey:    "configure.prefix",
+		},
+		{
+			name:       "env wins over file",
+			env:        map[string]string{"PASTURES_PREFIX": "env"},
+			file:       "configure:\n  prefix: file\n",
+			wantValue:  "env",
+			wantSource: sourceEnv,
+			wantKey:    "prefix",
+		},
+		{
+			name:       "flag wins over env and file",
+			args:       []string{"--prefix", "flag"},
+			env:        map[string]string{"PASTURES_CONFIGURE_PREFIX": "env"},
+			file:       "configure:\n  prefix: file\n",
+			wantValue:  "flag",
+			wantSource: sourceFlag,
+			wantKey:    "configure.prefix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+
+			viper.SetConfigType("yaml")
+			if err := viper.ReadConfig(strings.NewReader(tt.file)); err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cmd := testCommand(t, tt.args...)
+			s := resolveSetting(cmd, cmd.Flags().Lookup("prefix"))
+
+			if s.Value != tt.wantValue || s.Source != tt.wantSource || s.Key != tt.wantKey {
+				t.Errorf(
+					"resolveSetting() = %s from %s (%s), want %s from %s (%s)",
+					s.Value, s.Source, s.Key,
+					tt.wantValue, tt.wantSource, tt.wantKey,
+				)
+			}
+		})
+	}
+}
+
+func TestApplySettingsNotExplicit(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader("prefix: file\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := testCommand(t)
+	if err := applySettings(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	f := cmd.Flags().Lookup("prefix")
+
+	if f.Value.String() != "file" || !f.Changed {
+		t.Errorf("applySettings() left --prefix at %s, changed %v", f.Value, f.Changed)
+	}
+
+	if explicitlySet(cmd, "prefix") {
+		t.Errorf("explicitlySet() = true for a value from the config file")
+	}
+
+	if s := resolveSetting(cmd, f); s.Source != sourceFile {
+		t.Errorf("resolveSetting() source = %s after applySettings, want %s", s.Source, sourceFile)
+	}
+
+	if cmd := testCommand(t, "--prefix", "flag"); !explicitlySet(cmd, "prefix") {
+		t.Errorf("explicitlySet() = false for a flag on the command line")
+	}
+}
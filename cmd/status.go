@@ -0,0 +1,149 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+type stageStatus struct {
+	Name        string `json:"name" yaml:"name"`
+	Type        string `json:"type" yaml:"type"`
+	Path        string `json:"path" yaml:"path"`
+	Initialized bool   `json:"initialized" yaml:"initialized"`
+	RemoteState bool   `json:"remote_state" yaml:"remote_state"`
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Displays the local pasture configuration",
+	Long: "Displays the pasture configured on this machine, the Fabric " +
+		"FAST version checked out and the state of each stage. Status " +
+		"only reads local files and makes no calls to Google Cloud.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.Error("Unable to set configuration path")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		varFile := fabric.LoadVarsFile(path, "")
+		varData := fabric.NewFastConfig()
+
+		if err := varData.ReadConfig(varFile.LocalPath); err != nil {
+			output.Error(
+				"No pasture configured.",
+				"Try running pasture configure",
+			)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		varFile.SetBucket(varData.Prefix)
+
+		stages := fabric.InitializeFoundationStages(
+			path,
+			varData.Prefix,
+			varData.Stages(),
+			varFile,
+		)
+
+		fastRef, err := stages[0].Repository.Describe()
+		if err != nil {
+			fastRef = "not cloned"
+		}
+
+		seeds, _ := fabric.InstalledSeeds(path)
+		for _, name := range seeds {
+			seed := fabric.NewSeedStage(path)
+			seed.HydrateSeed(name, varData.Prefix, path)
+			stages = append(stages, seed)
+		}
+
+		statuses := make([]stageStatus, 0)
+		for _, s := range stages {
+			_, err := os.Stat(s.ProviderFile.LocalPath)
+
+			statuses = append(statuses, stageStatus{
+				Name:        s.Name,
+				Type:        s.Type,
+				Path:        s.Path,
+				Initialized: s.Initialized(),
+				RemoteState: err == nil,
+			})
+		}
+
+		output.Set("prefix", varData.Prefix)
+		output.Set("organization", varData.Organization)
+		output.Set("bucket", varFile.Bucket)
+		output.Set("fast_ref", fastRef)
+		output.Set("stages", statuses)
+
+		seedPath := ""
+		if varData.Meta != nil {
+			seedPath = varData.Meta.SeedPath
+		}
+
+		if seedPath != "" {
+			output.Set("seed_path", seedPath)
+		}
+
+		if output.Structured() {
+			return
+		}
+
+		fmt.Println("Prefix:      ", varData.Prefix)
+		if varData.Organization != nil {
+			fmt.Println("Organization:", varData.Organization.Domain)
+		}
+		fmt.Println("Bucket:      ", varFile.Bucket)
+		fmt.Println("FAST:        ", fastRef)
+		if seedPath != "" {
+			fmt.Println("Seeds:       ", seedPath)
+		}
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STAGE\tTYPE\tINITIALIZED\tREMOTE STATE")
+
+		for _, s := range statuses {
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%t\t%t\n",
+				s.Name,
+				s.Type,
+				s.Initialized,
+				s.RemoteState,
+			)
+		}
+
+		w.Flush()
+	},
+}
+
+func init() {
+	// Add the status command to the root command
+	RootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,237 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// updateConfig applies changed configure flags to an existing pasture
+// configuration, then writes and re-uploads it. The upload fails if the
+// remote configuration changed since it was downloaded.
+func updateConfig(
+	cmd *cobra.Command,
+	vars *fabric.VarsFile,
+	preview *configurePreview,
+) {
+	output.Info("Sourcing existing configuration from GCS bucket")
+
+	current := fabric.NewFastConfig()
+	updated := fabric.NewFastConfig()
+
+	// A preview reads a copy of the remote configuration, with its
+	// metadata, without replacing the local copy
+	configFile := vars.LocalPath
+
+	if preview != nil {
+		dir, err := os.MkdirTemp("", "pasture-config")
+		if err != nil {
+			output.CheckErr(output.Storage, err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		if configFile, err = vars.DownloadCopy(dir); err != nil {
+			output.Error("Cannot download existing pastures configuration")
+			output.CheckErr(output.Storage, err)
+		}
+	} else if err := vars.DownloadFile(); err != nil {
+		output.Error("Cannot download existing pastures configuration")
+		output.CheckErr(output.Storage, err)
+	}
+
+	for _, c := range []*fabric.FastConfig{current, updated} {
+		if err := c.ReadConfig(configFile); err != nil {
+			output.Error("Unable to read existing configuration")
+			output.CheckErr(output.Preflight, err)
+		}
+	}
+
+	// Apply only the flags given on the command line, not the defaults
+	// from the environment or the config file
+	explicit := func(name string) bool { return explicitlySet(cmd, name) }
+
+	if explicit("billing-account") {
+		noIam := updated.BillingAccount != nil && updated.BillingAccount.No_Iam
+		updated.SetBilling(billingAccountId, noIam)
+	}
+
+	if slices.ContainsFunc(locationFlags, explicit) {
+		var current *fabric.Locations
+		if updated.Locations != nil {
+			l := *updated.Locations
+			l.PubSub = slices.Clone(l.PubSub)
+			current = &l
+		}
+
+		loc, res, err := resolveLocations(cmd, current)
+		if err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		if err := updated.SetLocations(loc); err != nil {
+			output.Error("Invalid locations")
+			output.CheckErr(output.Usage, err)
+		}
+
+		if res != nil {
+			updated.SetResidency(res)
+		}
+	}
+
+	if explicit("group-owner") {
+		updated.SetGroups(group)
+	}
+
+	// the sandbox hosts the seeds, so it stays as it was
+	if explicit("features") {
+		features := slices.Clone(fastFeatures)
+		if slices.Contains(current.EnabledFeatures(), "sandbox") {
+			features = append(features, "sandbox")
+		}
+
+		if err := updated.SetFeatures(features...); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+	}
+
+	changes, err := fabric.DiffConfig(current, updated)
+	if err != nil {
+		output.CheckErr(output.General, err)
+	}
+
+	// stages are kept in the metadata sidecar rather than the tfvars
+	if explicit("stages") {
+		if err := updated.SetStages(fastStageNames...); err != nil {
+			output.CheckErr(output.Usage, err)
+		}
+
+		before := strings.Join(current.Stages(), ",")
+		after := strings.Join(updated.Stages(), ",")
+
+		if before != after {
+			changes = append(
+				changes,
+				fabric.ConfigChange{Key: "stages", Old: before, New: after},
+			)
+		}
+	}
+
+	output.Set("changes", changes)
+
+	if len(changes) == 0 {
+		output.Info("Configuration is already up to date")
+		return
+	}
+
+	output.Info("Configuration changes:")
+	for _, c := range changes {
+		output.Infof("  %s: %s -> %s", c.Key, diffValue(c.Old), diffValue(c.New))
+	}
+
+	if preview != nil {
+		if explicit("group-owner") {
+			delta, err := google.OrgIAMDelta(
+				updated.Organization,
+				group,
+				groupIamRoles,
+			)
+			if err != nil {
+				output.Error("Unable to read organization IAM policy")
+				output.CheckErr(output.Auth, err)
+			}
+
+			preview.Iam = delta
+		}
+
+		j, err := updated.Marshal()
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		preview.ConfigFile = vars.LocalPath
+		preview.Config = j
+
+		return
+	}
+
+	if canPrompt() {
+		ok, err := utils.Confirm("Apply these changes?")
+		if err != nil {
+			output.CheckErr(output.General, err)
+		}
+
+		if !ok {
+			output.Info("Update cancelled - no changes were made")
+			return
+		}
+	}
+
+	// The new group needs the same prerequisite roles as the original
+	if explicit("group-owner") {
+		output.Info("Applying prerequisite roles to group:", group)
+
+		if err := google.SetRequiredOrgIAMRoles(
+			updated.Organization,
+			group,
+			groupIamRoles,
+		); err != nil {
+			output.Error("Unable to apply prerequisite roles to group:", group)
+			output.CheckErr(output.Auth, err)
+		}
+	}
+
+	output.Info("Writing configuration file to path:", vars.LocalPath)
+
+	vars.AddConfig(updated)
+
+	if err := vars.Config.WriteConfig(vars.LocalPath); err != nil {
+		output.Error("Unable to write config file to path")
+		output.CheckErr(output.Storage, err)
+	}
+
+	output.Info("Uploading pasture vars to GCS bucket")
+
+	if err := vars.UploadFile(); err != nil {
+		if errors.Is(err, google.ErrObjectChanged) {
+			output.Error(
+				"The remote configuration changed during the update - " +
+					"run configure --update again to apply on top of it",
+			)
+		} else {
+			output.Error("Failed to upload pasture var file")
+		}
+		output.CheckErr(output.Storage, err)
+	}
+}
+
+func diffValue(v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+
+	return v
+}
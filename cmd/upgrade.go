@@ -0,0 +1,446 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/history"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	upgradeVer          string
+	upgradeRepoUrl      string
+	upgradeDryRun       bool
+	upgradeYes          bool
+	upgradeIgnoreCompat bool
+)
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Moves a deployed foundation to a newer FAST release",
+	Long: "Clones the FAST release next to the current checkout, checks " +
+		"the pasture configuration against its bootstrap variables, " +
+		"re-applies the factories and overlays of the current checkout " +
+		"and plans every stage. The " +
+		"plans are applied once confirmed. On failure, or when cancelled, " +
+		"the foundation goes back to the current checkout. An example:\n\n\t" +
+		"pasture upgrade --fabric-version v33.0.0",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := utils.ConfigPath()
+		if err != nil {
+			output.Error("Unable to set configuration path")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		email, err := google.AppDefaultCredentials()
+		if err != nil {
+			output.CheckErr(output.Auth, err)
+		}
+
+		history.SetUser(email)
+
+		varFile := fabric.LoadVarsFile(path, "")
+		varData := fabric.NewFastConfig()
+
+		if err := varData.ReadConfig(varFile.LocalPath); err != nil {
+			output.Error(
+				"Unable to read var file.",
+				"Try running pasture configure --rehydrate",
+			)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		varFile.AddConfig(varData)
+		varFile.SetBucket(varData.Prefix)
+		history.SetBucket(varFile.Bucket)
+
+		stages := fabric.InitializeFoundationStages(
+			path,
+			varData.Prefix,
+			varData.Stages(),
+			varFile,
+		)
+
+		current := stages[0].Repository
+
+		from, err := current.Describe()
+		if err != nil {
+			output.Error("No FAST checkout found. Try running pasture configure")
+			output.CheckErr(output.Preflight, err)
+		}
+
+		if from == upgradeVer {
+			output.Info("Foundation already runs FAST", from)
+			return
+		}
+
+		if semver.IsValid(from) && semver.Compare(upgradeVer, from) < 0 {
+			output.CheckErr(output.Usage, fmt.Errorf(
+				"FAST %s is older than the deployed %s - downgrades are not "+
+					"supported", upgradeVer, from,
+			))
+		}
+
+		history.SetFastRef(upgradeVer)
+		output.Set("from", from)
+		output.Set("to", upgradeVer)
+
+		checkUpgradeVersion(varData)
+
+		// clone the release next to the current checkout
+		next := fabric.NewUpgradeRepo(path, upgradeRepoUrl, upgradeVer)
+
+		output.Infof("Cloning FAST %s next to %s", upgradeVer, from)
+
+		if err := next.CheckRef(); err != nil {
+			output.Error("Unable to find", next.Ref, "in", next.Url)
+
+			if errors.Is(err, utils.ErrRefNotFound) {
+				output.CheckErr(output.Usage, err)
+			}
+			output.CheckErr(output.General, err)
+		}
+
+		if err := next.Clone(true); err != nil {
+			output.Error("Unable to clone repository")
+			output.CheckErr(output.General, err)
+		}
+
+		commit, err := next.Commit()
+		if err == nil {
+			err = fabric.VerifyFastCommit(upgradeVer, commit)
+		}
+
+		if err != nil {
+			output.Error("Unable to verify the FAST checkout")
+			utils.RemoveDir(next.Dst)
+			output.CheckErr(output.Preflight, err)
+		}
+
+		// keep what rollback needs to put back
+		previous := fabric.NewFastConfig()
+		if err := previous.ReadConfig(varFile.LocalPath); err != nil {
+			output.CheckErr(output.Preflight, err)
+		}
+
+		restoreOverlays, err := fabric.SnapshotOverlays(path)
+		if err != nil {
+			output.CheckErr(output.Storage, err)
+		}
+
+		// the generation of the remote vars once planned, so rollback can
+		// tell whether the migrated vars were published
+		planned := int64(-1)
+
+		rollback := func() {
+			output.Info("Going back to FAST", from)
+
+			errs := []error{
+				current.Link.Link(),
+				restoreOverlays(),
+				previous.WriteConfig(varFile.LocalPath),
+				utils.RemoveDir(next.Dst),
+			}
+
+			if planned >= 0 && varFile.Generation != planned {
+				output.Info("Restoring the pasture vars in", varFile.Bucket)
+
+				if err := varFile.UploadFile(); err != nil {
+					errs = append(errs, fmt.Errorf(
+						"migrated pasture vars are left in %s: %w",
+						varFile.Bucket, err,
+					))
+				}
+			}
+
+			if err := errors.Join(errs...); err != nil {
+				output.Error("Unable to roll back cleanly:", err)
+			}
+		}
+
+		fail := func(c output.Category, err error, msg ...any) {
+			output.Error(msg...)
+			rollback()
+			output.CheckErr(c, err)
+		}
+
+		output.Info("Checking configuration against FAST", upgradeVer)
+
+		bootstrap := fabric.CheckoutStagePath(next.Dst, stages[0].Name)
+
+		err = varData.MigrateFast(upgradeVer, bootstrap)
+		if errors.Is(err, fabric.ErrVariableMismatch) {
+			fail(
+				output.Preflight, err,
+				"Configuration does not match the variables of FAST "+upgradeVer+".",
+				"Adjust the variables with pasture config set and check the "+
+					"upgrade with pasture upgrade --dry-run",
+			)
+		} else if err != nil {
+			fail(output.Preflight, err, "Unable to migrate configuration")
+		}
+
+		if err := varData.WriteConfig(varFile.LocalPath); err != nil {
+			fail(output.Storage, err, "Unable to write config file to path")
+		}
+
+		// factories are read from the current checkout before relinking
+		factories := make(map[string][]fabric.FabricFactory)
+
+		for _, s := range stages {
+			f, err := fabric.UpgradeFactories(
+				path,
+				s,
+				fabric.CheckoutStagePath(current.Dst, s.Name),
+			)
+			if err != nil {
+				fail(output.Storage, err, "Unable to read factories of", s.Name)
+			}
+
+			factories[s.Name] = f
+		}
+
+		if err := next.Link.Link(); err != nil {
+			fail(output.Storage, err, "Unable to link repository target to directory")
+		}
+
+		for _, s := range stages {
+			for _, f := range factories[s.Name] {
+				output.Infof("Updating %s factory of %s", f.Target(), s.Name)
+				s.SetFactory(f)
+
+				if err := f.ApplyFactory(varData.Prefix); err != nil {
+					fail(output.Storage, err, "Unable to update factory:", f.Target())
+				}
+			}
+		}
+
+		graph, err := fabric.NewGraph(stages)
+		if err != nil {
+			fail(output.General, err, "Unable to order stages")
+		}
+
+		// plan in order, as later stages read what earlier ones publish
+		plans := make(map[string]string)
+
+		for _, s := range graph.Order(false) {
+			output.Stage(s.Name, "Planning stage:", s.Name)
+
+			if err := prepareUpgradeStage(s, varData, varFile); err != nil {
+				fail(output.CategoryOf(err), err, "Unable to prepare stage:", s.Name)
+			}
+
+			diff, err := s.Diff(verbose)
+			if err != nil {
+				fail(output.Terraform, err, "Unable to plan stage:", s.Name)
+			}
+
+			plans[s.Name] = diff
+
+			if !output.Structured() {
+				fmt.Println(diff)
+			}
+		}
+
+		output.Set("plans", plans)
+
+		if upgradeDryRun {
+			output.Info("Dry run - nothing was applied")
+			rollback()
+			return
+		}
+
+		planned = varFile.Generation
+
+		if !upgradeYes {
+			if !canPrompt() {
+				fail(
+					output.Usage,
+					errors.New("pass --yes to apply the upgrade without a terminal"),
+					"Upgrade needs confirmation",
+				)
+			}
+
+			ok, err := utils.Confirm("Apply the upgrade to FAST " + upgradeVer + "?")
+			if err != nil {
+				fail(output.General, err, "Unable to read confirmation")
+			}
+
+			if !ok {
+				output.Info("Upgrade cancelled - nothing was applied")
+				rollback()
+				return
+			}
+		}
+
+		err = graph.Run(false, func(s *fabric.Stage) error {
+			return applyUpgradeStage(s, varData, varFile)
+		})
+		if err != nil {
+			output.Warn(fmt.Sprintf(
+				"Stages applied before the failure run FAST %s - the pasture "+
+					"vars are put back, so run pasture upgrade again, or "+
+					"pasture create foundation to re-apply %s",
+				upgradeVer, from,
+			))
+			fail(output.CategoryOf(err), err, "Upgrade failed")
+		}
+
+		if err := fabric.FinishUpgrade(path, next); err != nil {
+			output.Error("Unable to replace the FAST checkout")
+			output.CheckErr(output.Storage, err)
+		}
+
+		output.Infof("Foundation upgraded from FAST %s to %s", from, upgradeVer)
+	},
+}
+
+// checkUpgradeVersion warns about untested FAST releases and refuses one
+// the seeds of the pasture do not work with
+func checkUpgradeVersion(varData *fabric.FastConfig) {
+	if !fabric.TestedFastVersion(upgradeVer) {
+		output.Warn(fmt.Sprintf(
+			"FAST %s is not tested with pasture %s - tested versions are %s",
+			upgradeVer, pastureVer,
+			strings.Join(fabric.TestedFastVersions(), ", "),
+		))
+	}
+
+	if varData.Meta == nil || varData.Meta.SeedVersion == "" {
+		return
+	}
+
+	err := fabric.CheckCompatibility(upgradeVer, varData.Meta.SeedVersion)
+
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, fabric.ErrUnknownCompatibility), upgradeIgnoreCompat:
+		output.Warn(err.Error())
+		return
+	}
+
+	output.Error("Pass --ignore-compatibility to upgrade anyway")
+	output.CheckErr(output.Preflight, err)
+}
+
+// prepareUpgradeStage fetches the files the stage reads and initializes it.
+// The migrated pasture vars replace the remote copy until they are applied.
+func prepareUpgradeStage(
+	s *fabric.Stage,
+	varData *fabric.FastConfig,
+	varFile *fabric.VarsFile,
+) error {
+	if err := s.DiscoverFiles(); err != nil {
+		output.Error("Foundation is not deployed. Try running pasture create foundation")
+		return output.Fail(output.Storage, err)
+	}
+
+	if len(s.Uploads) > 0 {
+		if err := varData.WriteConfig(varFile.LocalPath); err != nil {
+			return output.Fail(output.Storage, err)
+		}
+	}
+
+	if err := s.Init(verbose); err != nil {
+		return output.Fail(output.Terraform, err)
+	}
+
+	return nil
+}
+
+// applyUpgradeStage applies a stage on the new release and publishes its
+// outputs for the stages after it
+func applyUpgradeStage(
+	s *fabric.Stage,
+	varData *fabric.FastConfig,
+	varFile *fabric.VarsFile,
+) error {
+	history.AddStage(s.Name)
+
+	output.Stage(s.Name, "Upgrading stage:", s.Name)
+
+	if err := prepareUpgradeStage(s, varData, varFile); err != nil {
+		return err
+	}
+
+	if err := s.Apply(nil, verbose); err != nil {
+		output.Error("Stage failed to deploy:", s.Name)
+		return output.Fail(output.Terraform, err)
+	}
+
+	if len(s.Uploads) > 0 {
+		output.Info("Uploading pasture vars to GCS bucket")
+
+		if err := s.UploadOutputs(); err != nil {
+			output.Error("Failed to upload pasture var file")
+			return output.Fail(output.Storage, err)
+		}
+	}
+
+	output.Stage(s.Name, "Stage complete:", s.Name)
+
+	return nil
+}
+
+func init() {
+	fast, _ := fabric.RepoURL("fast")
+
+	upgradeCmd.Flags().
+		StringVar(
+			&upgradeVer, "fabric-version", "",
+			"Cloud Foundation Fabric FAST version to upgrade to",
+		)
+	upgradeCmd.Flags().
+		StringVar(
+			&upgradeRepoUrl, "fabric-repo", fast,
+			"Git URL or local path of a Cloud Foundation Fabric mirror",
+		)
+	upgradeCmd.Flags().
+		BoolVar(
+			&upgradeDryRun, "dry-run", false,
+			"Plan the upgrade and go back to the current release",
+		)
+	upgradeCmd.Flags().
+		BoolVar(
+			&upgradeYes, "yes", false,
+			"Apply the plans without asking for confirmation",
+		)
+	upgradeCmd.Flags().
+		BoolVar(
+			&upgradeIgnoreCompat, "ignore-compatibility", false,
+			"Upgrade even if the seeds do not work with the FAST version",
+		)
+
+	if err := upgradeCmd.MarkFlagRequired("fabric-version"); err != nil {
+		cobra.CheckErr(err)
+	}
+
+	// Add the upgrade command to the root command
+	RootCmd.AddCommand(upgradeCmd)
+}
@@ -17,8 +17,7 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -29,7 +28,8 @@ var versionCmd = &cobra.Command{
 	Long:  "Displays Pasture binary version",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Pastures version", pastureVer)
+		output.Set("version", pastureVer)
+		output.Info("Pastures version", pastureVer)
 	},
 }
 
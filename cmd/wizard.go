@@ -0,0 +1,327 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/fabric"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+)
+
+const (
+	defaultGroupName = "gcp-pasture-admins"
+	maxPrefixLength  = 9
+)
+
+// missingConfigureFlags lists the flags configure needs but was not given
+func missingConfigureFlags() []string {
+	var missing []string
+
+	if prefix == "" {
+		missing = append(missing, "--prefix")
+	}
+
+	if rehydrate || configUpdate {
+		return missing
+	}
+
+	if orgDomain == "" {
+		missing = append(missing, "--domain")
+	}
+
+	if billingAccountId == "" {
+		missing = append(missing, "--billing-account")
+	}
+
+	if group == "" {
+		missing = append(missing, "--group-owner")
+	}
+
+	return missing
+}
+
+// canPrompt reports whether configure may fall back to interactive prompts
+func canPrompt() bool {
+	return utils.IsTerminal() && !output.Structured()
+}
+
+// runWizard fills in missing configure flags interactively and asks the
+// user to confirm before anything is changed. It returns false if the user
+// declined. Groups are not created when a preview is being collected.
+func runWizard(
+	configPath string,
+	askLocation bool,
+	preview *configurePreview,
+) (bool, error) {
+	output.Info("\nSome required flags were not set - starting guided setup")
+
+	if rehydrate || configUpdate {
+		p, err := promptPrefix(configPath, true)
+		if err != nil {
+			return false, err
+		}
+
+		prefix = p
+
+		return true, nil
+	}
+
+	org, err := selectOrganization()
+	if err != nil {
+		return false, err
+	}
+
+	orgDomain = org.Domain
+
+	if billingAccountId == "" {
+		if billingAccountId, err = selectBillingAccount(); err != nil {
+			return false, err
+		}
+	}
+
+	if prefix == "" {
+		if prefix, err = promptPrefix(configPath, false); err != nil {
+			return false, err
+		}
+	}
+
+	if group == "" {
+		if group, err = selectGroup(org, preview); err != nil {
+			return false, err
+		}
+	}
+
+	if askLocation {
+		i, err := utils.Select(
+			"Select a multi-region location:",
+			fabric.MultiRegions,
+		)
+		if err != nil {
+			return false, err
+		}
+
+		location = fabric.MultiRegions[i]
+	}
+
+	fmt.Println("\nPasture configuration summary:")
+	fmt.Println("  Organization:    ", orgDomain)
+	fmt.Println("  Billing account: ", billingAccountId)
+	fmt.Println("  Prefix:          ", prefix)
+	fmt.Println("  Group owner:     ", group+"@"+orgDomain)
+	if residency != "" {
+		fmt.Println("  Residency:       ", residency)
+	} else {
+		fmt.Println("  Location:        ", location)
+	}
+	fmt.Println("\nThe group owner will be granted these organization roles:")
+
+	for _, r := range groupIamRoles {
+		fmt.Println("  -", r)
+	}
+
+	fmt.Println()
+
+	if preview != nil {
+		return true, nil
+	}
+
+	return utils.Confirm("Apply roles and write the configuration?")
+}
+
+func selectOrganization() (*google.Organization, error) {
+	if orgDomain != "" {
+		return google.GetOrganization(orgDomain)
+	}
+
+	orgs, err := google.ListOrganizations()
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(orgs) {
+	case 0:
+		return nil, errors.New("no organizations are visible to the current user")
+	case 1:
+		output.Info("Using organization:", orgs[0].Domain)
+		return &orgs[0], nil
+	}
+
+	options := make([]string, len(orgs))
+	for i, o := range orgs {
+		options[i] = fmt.Sprintf("%s (%d)", o.Domain, o.Id)
+	}
+
+	i, err := utils.Select("Select a GCP organization:", options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &orgs[i], nil
+}
+
+func selectBillingAccount() (string, error) {
+	accounts, err := google.ListBillingAccounts()
+	if err != nil {
+		output.Warn("Unable to list billing accounts:", err)
+	}
+
+	var open []google.BillingAccount
+	for _, a := range accounts {
+		if a.Open {
+			open = append(open, a)
+		}
+	}
+
+	if len(open) == 0 {
+		return utils.Prompt("Billing account ID", "")
+	}
+
+	options := make([]string, len(open))
+	for i, a := range open {
+		options[i] = fmt.Sprintf("%s (%s)", a.DisplayName, a.Id)
+	}
+
+	i, err := utils.Select("Select a billing account:", options)
+	if err != nil {
+		return "", err
+	}
+
+	return open[i].Id, nil
+}
+
+// promptPrefix asks for a prefix until a valid one is given. New
+// configurations must use an unused prefix, rehydration an existing one.
+func promptPrefix(configPath string, existing bool) (string, error) {
+	proposed := ""
+	if !existing {
+		proposed = proposePrefix(configPath)
+	}
+
+	for {
+		p, err := utils.Prompt("Resource prefix (max 9 characters)", proposed)
+		if err != nil {
+			return "", err
+		}
+
+		if err := fabric.ValidatePrefix(p); err != nil {
+			fmt.Println("Invalid prefix:", err)
+			continue
+		}
+
+		if inUse := prefixInUse(configPath, p); inUse != existing {
+			if existing {
+				fmt.Println("No existing pasture found for prefix", p)
+			} else {
+				fmt.Println("A pasture already exists for prefix", p)
+			}
+			continue
+		}
+
+		return p, nil
+	}
+}
+
+// proposePrefix derives an unused prefix from the organization domain
+func proposePrefix(configPath string) string {
+	base := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(strings.Split(orgDomain, ".")[0]))
+
+	base = strings.TrimLeft(base, "0123456789")
+	if base == "" {
+		base = "pasture"
+	}
+
+	if len(base) > maxPrefixLength-2 {
+		base = base[:maxPrefixLength-2]
+	}
+
+	candidate := base
+	for i := 1; i < 100 && prefixInUse(configPath, candidate); i++ {
+		candidate = base + strconv.Itoa(i)
+	}
+
+	return candidate
+}
+
+func prefixInUse(configPath string, p string) bool {
+	return fabric.LoadVarsFile(configPath, p).GetFileMetadata() == nil
+}
+
+// selectGroup returns the name of an existing or newly created group in
+// the organization's primary domain
+func selectGroup(
+	org *google.Organization,
+	preview *configurePreview,
+) (string, error) {
+	suffix := "@" + org.Domain
+
+	groups, err := google.ListGroups(org.CustomerId)
+	if err != nil {
+		output.Warn("Unable to list Cloud Identity groups:", err)
+
+		name, err := utils.Prompt("Group owner name", defaultGroupName)
+		return strings.TrimSuffix(name, suffix), err
+	}
+
+	var options []string
+	for _, g := range groups {
+		if strings.HasSuffix(g.Email, suffix) {
+			options = append(options, g.Email)
+		}
+	}
+
+	options = append(options, "Create a new group")
+
+	i, err := utils.Select("Select the group that owns the pasture:", options)
+	if err != nil {
+		return "", err
+	}
+
+	if i < len(options)-1 {
+		return strings.TrimSuffix(options[i], suffix), nil
+	}
+
+	name, err := utils.Prompt("New group name", defaultGroupName)
+	if err != nil {
+		return "", err
+	}
+
+	name = strings.TrimSuffix(name, suffix)
+
+	if preview != nil {
+		preview.Groups = append(preview.Groups, name+suffix)
+		return name, nil
+	}
+
+	output.Info("Creating group:", name+suffix)
+
+	if _, err := google.CreateGroup(org.CustomerId, name+suffix, name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
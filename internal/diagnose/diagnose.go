@@ -0,0 +1,141 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	userRulesFile = "diagnostics.yaml"
+)
+
+//go:embed rules.yaml
+var builtinRules []byte
+
+// LoadRules returns the built-in rules merged with the rules in the
+// diagnostics file of the config path, if one exists
+func LoadRules(configPath string) (*RuleSet, error) {
+	rules, err := parseRules(builtinRules, "built-in rules")
+	if err != nil {
+		return nil, err
+	}
+
+	p := filepath.Join(configPath, userRulesFile)
+
+	data, err := utils.ReadFile(p)
+	if os.IsNotExist(err) {
+		return rules, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	user, err := parseRules(data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	rules.merge(user)
+
+	return rules, nil
+}
+
+// Diagnose returns the remediation hints of every rule matching the error
+func (r *RuleSet) Diagnose(err error) []Match {
+	matches := make([]Match, 0)
+
+	if err == nil {
+		return matches
+	}
+
+	text := err.Error()
+
+	for _, rule := range r.Rules {
+		m := rule.re.FindStringSubmatchIndex(text)
+		if m == nil {
+			continue
+		}
+
+		hint := rule.re.ExpandString(nil, rule.Hint, text, m)
+
+		matches = append(matches, Match{
+			Rule: rule.Name,
+			Hint: strings.TrimSpace(string(hint)),
+			Docs: rule.Docs,
+		})
+
+		if rule.Stop {
+			break
+		}
+	}
+
+	return matches
+}
+
+// merge adds user rules, replacing built-in rules that share a name
+func (r *RuleSet) merge(user *RuleSet) {
+	for _, u := range user.Rules {
+		replaced := false
+
+		for i, b := range r.Rules {
+			if b.Name == u.Name {
+				r.Rules[i] = u
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			r.Rules = append(r.Rules, u)
+		}
+	}
+}
+
+func parseRules(data []byte, source string) (*RuleSet, error) {
+	var rules RuleSet
+
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", source, err)
+	}
+
+	for i, rule := range rules.Rules {
+		if rule.Name == "" || rule.Pattern == "" || rule.Hint == "" {
+			return nil, fmt.Errorf(
+				"rule %d in %s must have a name, pattern and hint", i+1, source,
+			)
+		}
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid pattern for rule %s in %s: %w", rule.Name, source, err,
+			)
+		}
+
+		rule.re = re
+	}
+
+	return &rules, nil
+}
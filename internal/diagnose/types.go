@@ -0,0 +1,39 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import "regexp"
+
+type RuleSet struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+type Rule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Hint    string `yaml:"hint"`
+	Docs    string `yaml:"docs"`
+	Stop    bool   `yaml:"stop"`
+
+	re *regexp.Regexp
+}
+
+type Match struct {
+	Rule string `json:"rule" yaml:"rule"`
+	Hint string `json:"hint" yaml:"hint"`
+	Docs string `json:"docs,omitempty" yaml:"docs,omitempty"`
+}
@@ -0,0 +1,266 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/terraform"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+)
+
+// A bundle holds the cache entries of the FAST and seed checkouts, with
+// their terraform modules downloaded, and a filesystem mirror of the
+// providers they require
+const (
+	bundleDir       = "bundle"
+	bundleManifest  = "bundle.json"
+	bundleCache     = "cache"
+	bundleProviders = "providers"
+)
+
+// bundleCliConfig makes terraform install providers from the bundle only
+const bundleCliConfig = `provider_installation {
+  filesystem_mirror {
+    path    = %q
+    include = ["*/*"]
+  }
+  direct {
+    exclude = ["*/*"]
+  }
+}
+`
+
+// DefaultPlatform is the terraform platform of the running binary
+func DefaultPlatform() string {
+	return runtime.GOOS + "_" + runtime.GOARCH
+}
+
+// CreateBundle packs the FAST and seed checkouts at the tags of opts, their
+// modules and the providers they require into a .tar.gz archive
+func CreateBundle(configPath string, archive string, opts *BundleOptions) (*Bundle, error) {
+	staging, err := os.MkdirTemp("", "pasture-bundle")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(staging)
+
+	fast, err := bundleRepo(configPath, staging, opts.FastUrl, opts.FastVersion)
+	if err != nil {
+		return nil, fmt.Errorf("FAST %s: %w", opts.FastVersion, err)
+	}
+
+	seed, err := bundleRepo(configPath, staging, opts.SeedUrl, opts.SeedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("seeds %s: %w", opts.SeedVersion, err)
+	}
+
+	// every configuration terraform runs in from the bundle
+	dirs := make([]string, 0)
+
+	for _, spec := range StageCatalog {
+		dirs = append(
+			dirs,
+			filepath.Join(staging, bundleCache, fast.Key, fastSrc, spec.Name),
+		)
+	}
+
+	seeds, err := os.ReadDir(filepath.Join(staging, bundleCache, seed.Key, seedSrc))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range seeds {
+		if s.IsDir() {
+			dirs = append(
+				dirs,
+				filepath.Join(staging, bundleCache, seed.Key, seedSrc, s.Name()),
+			)
+		}
+	}
+
+	providers := filepath.Join(staging, bundleProviders)
+
+	for _, d := range dirs {
+		if _, err := os.Stat(d); errors.Is(err, fs.ErrNotExist) {
+			continue // a stage this FAST version does not have
+		}
+
+		if err := terraform.TfGetModules(d, opts.Verbose); err != nil {
+			return nil, fmt.Errorf("modules of %s: %w", filepath.Base(d), err)
+		}
+
+		if err := terraform.TfProvidersMirror(d, providers, opts.Platforms); err != nil {
+			return nil, err
+		}
+	}
+
+	tfVersion, err := terraform.TfVersion(staging)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		PastureVersion:   opts.PastureVersion,
+		TerraformVersion: tfVersion,
+		Os:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		Platforms:        opts.Platforms,
+		Fast:             fast,
+		Seed:             seed,
+		Created:          time.Now().UTC(),
+	}
+
+	data, err := json.MarshalIndent(b, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.CreateFile(filepath.Join(staging, bundleManifest), data, true); err != nil {
+		return nil, err
+	}
+
+	return b, utils.CreateArchive(staging, archive)
+}
+
+// bundleRepo copies the cache entry of url at tag into the staging cache,
+// cloning it into the cache of the config path first when needed
+func bundleRepo(configPath string, staging string, url string, tag string) (*utils.CacheEntry, error) {
+	repo := utils.NewRepo()
+	repo.SetURL(url)
+	repo.SetRef("refs/tags/" + tag)
+	repo.SetCache(utils.CachePath(configPath))
+
+	src, err := repo.Cached()
+	if err != nil {
+		return nil, err
+	}
+
+	key := filepath.Base(src)
+
+	entry, err := utils.ReadCacheEntry(repo.Cache, key)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := filepath.Join(staging, bundleCache)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := utils.CopyPath(src, filepath.Join(dst, key)); err != nil {
+		return nil, err
+	}
+
+	return entry, utils.CopyPath(src+".json", filepath.Join(dst, key+".json"))
+}
+
+// ImportBundle unpacks a bundle under the config path, moves its checkouts
+// into the clone cache and points terraform at its provider mirror
+func ImportBundle(configPath string, archive string) (*Bundle, error) {
+	dir := filepath.Join(configPath, bundleDir)
+	tmp := dir + ".tmp"
+
+	if err := utils.RemoveDir(tmp); err != nil {
+		return nil, err
+	}
+
+	// keep the bundle imported before unless this one unpacks
+	if err := utils.ExtractArchive(archive, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	if err := utils.RemoveDir(dir); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, err
+	}
+
+	b, err := ImportedBundle(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("%s is not a pasture bundle", archive)
+	}
+
+	cache := utils.CachePath(configPath)
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, bundleCache))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		dst := filepath.Join(cache, e.Name())
+
+		if err := os.RemoveAll(dst); err != nil {
+			return nil, err
+		}
+
+		if err := os.Rename(filepath.Join(dir, bundleCache, e.Name()), dst); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := utils.RemoveDir(filepath.Join(dir, bundleCache)); err != nil {
+		return nil, err
+	}
+
+	rc := fmt.Sprintf(bundleCliConfig, filepath.Join(dir, bundleProviders))
+
+	return b, utils.CreateFile(terraform.CliConfigPath(configPath), []byte(rc), true)
+}
+
+// ImportedBundle returns the bundle imported under the config path, or nil
+// when there is none
+func ImportedBundle(configPath string) (*Bundle, error) {
+	data, err := os.ReadFile(filepath.Join(configPath, bundleDir, bundleManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+
+	return b, nil
+}
+
+// RemoveBundle removes the imported bundle, so terraform installs providers
+// from their registries again. Its checkouts stay in the clone cache.
+func RemoveBundle(configPath string) error {
+	return utils.RemoveDir(filepath.Join(configPath, bundleDir))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const networkingPrefix = "2-networking-"
+
+// StageCatalog lists the FAST stages pastures can run, in apply order.
+// Stages that are not Required are opt-in with configure --stages.
+var StageCatalog = []StageSpec{
+	{
+		Name:     "0-bootstrap",
+		Provider: "0-bootstrap",
+		Produces: []string{"0-globals", "0-bootstrap"},
+		Required: true,
+	},
+	{
+		Name:         "1-resman",
+		Provider:     "1-resman",
+		Dependencies: []string{"0-globals", "0-bootstrap"},
+		Produces:     []string{"1-resman"},
+		Required:     true,
+	},
+	{
+		Name:         "2-networking-a-simple",
+		Provider:     "2-networking",
+		Dependencies: []string{"0-globals", "0-bootstrap", "1-resman"},
+		Produces:     []string{"2-networking"},
+	},
+	{
+		Name:         "2-networking-b-nva",
+		Provider:     "2-networking",
+		Dependencies: []string{"0-globals", "0-bootstrap", "1-resman"},
+		Produces:     []string{"2-networking"},
+	},
+	{
+		Name:         "2-networking-c-separate-envs",
+		Provider:     "2-networking",
+		Dependencies: []string{"0-globals", "0-bootstrap", "1-resman"},
+		Produces:     []string{"2-networking"},
+	},
+	{
+		Name:         "2-security",
+		Provider:     "2-security",
+		Dependencies: []string{"0-globals", "0-bootstrap", "1-resman"},
+		Produces:     []string{"2-security"},
+	},
+}
+
+// OptionalStages returns the names of the stages that can be opted into
+func OptionalStages() []string {
+	names := make([]string, 0)
+
+	for _, s := range StageCatalog {
+		if !s.Required {
+			names = append(names, s.Name)
+		}
+	}
+
+	return names
+}
+
+// GetStageSpec returns the catalog entry of a stage
+func GetStageSpec(name string) (*StageSpec, error) {
+	for i := range StageCatalog {
+		if StageCatalog[i].Name == name {
+			return &StageCatalog[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf(
+		"unknown stage %q - must be one of %s",
+		name, strings.Join(OptionalStages(), ", "),
+	)
+}
+
+// ValidateStages checks that every stage is optional and that at most one
+// networking stage is selected, as they all deploy the same resources
+func ValidateStages(names []string) error {
+	var networking string
+
+	for _, n := range names {
+		spec, err := GetStageSpec(n)
+		if err != nil {
+			return err
+		}
+
+		if spec.Required {
+			return fmt.Errorf("stage %s is always deployed", n)
+		}
+
+		if strings.HasPrefix(n, networkingPrefix) {
+			if networking != "" && networking != n {
+				return fmt.Errorf(
+					"only one networking stage can be deployed, got %s and %s",
+					networking, n,
+				)
+			}
+
+			networking = n
+		}
+	}
+
+	return nil
+}
+
+// producers returns the stages that write the given tfvars
+func producers(specs []StageSpec, deps []string) []string {
+	names := make([]string, 0)
+
+	for _, s := range specs {
+		for _, p := range s.Produces {
+			if slices.Contains(deps, p) && !slices.Contains(names, s.Name) {
+				names = append(names, s.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// catalogStages returns the required stages and the selected optional
+// ones in catalog order
+func catalogStages(selected []string) []StageSpec {
+	specs := make([]StageSpec, 0)
+
+	for _, s := range StageCatalog {
+		if s.Required || slices.Contains(selected, s.Name) {
+			specs = append(specs, s)
+		}
+	}
+
+	return specs
+}
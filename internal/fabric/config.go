@@ -19,9 +19,13 @@ package fabric
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 )
 
@@ -58,32 +62,121 @@ func (f *FastConfig) SetUser(e string) {
 	f.BootstrapUser = e
 }
 
-// TODO: move sandbox default somewhere else
-func (f *FastConfig) SetFeatures(sandbox bool) {
+// FeatureNames are the FAST resman branches that can be enabled
+var FeatureNames = []string{
+	"data_platform",
+	"gcve",
+	"gke",
+	"project_factory",
+	"sandbox",
+	"teams",
+}
+
+// SetFeatures enables the named FAST resman branches, e.g. sandbox or
+// gke; every other branch is turned off
+func (f *FastConfig) SetFeatures(names ...string) error {
 	var a FastFeatures
 
-	a.Sandbox = sandbox
+	switches := a.switches()
+
+	for _, n := range names {
+		on, ok := switches[strings.ReplaceAll(strings.ToLower(n), "-", "_")]
+		if !ok {
+			return fmt.Errorf(
+				"unknown FAST feature %q - must be one of %s",
+				n,
+				strings.Join(FeatureNames, ", "),
+			)
+		}
+
+		*on = true
+	}
+
 	f.FastFeatures = &a
+
+	return nil
 }
 
-// TODO: update to support various field types in struct
-func (f *FastConfig) SetLocations(l string) {
-	var loc Locations
+// EnabledFeatures lists the FAST branches turned on in the config
+func (f *FastConfig) EnabledFeatures() []string {
+	var names []string
+
+	if f.FastFeatures == nil {
+		return names
+	}
+
+	switches := f.FastFeatures.switches()
 
-	// TODO: this should be field targeted with reflectino loop
-	loc.Bq = l
-	loc.Gcs = l
+	for _, n := range FeatureNames {
+		if *switches[n] {
+			names = append(names, n)
+		}
+	}
 
-	// TODO: move these defaults somewhere else
-	loc.Logging = "global"
-	loc.PubSub = []string{}
+	return names
+}
 
-	f.Locations = &loc
+func (a *FastFeatures) switches() map[string]*bool {
+	return map[string]*bool{
+		"data_platform":   &a.DataPlatform,
+		"gcve":            &a.Gcve,
+		"gke":             &a.Gke,
+		"project_factory": &a.ProjectFactory,
+		"sandbox":         &a.Sandbox,
+		"teams":           &a.Teams,
+	}
+}
+
+// SetLocations validates and sets the location of each service
+func (f *FastConfig) SetLocations(l *Locations) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+
+	f.Locations = l
+
+	return nil
+}
+
+// SetResidency records the residency preset and default seed region
+func (f *FastConfig) SetResidency(r *Residency) {
+	if f.Meta == nil {
+		f.Meta = &ConfigMeta{}
+	}
+
+	f.Meta.Residency = r.Name
+	f.Meta.Region = r.Region
+}
+
+// SetStages records the optional FAST stages deployed with the foundation
+func (f *FastConfig) SetStages(names ...string) error {
+	if err := ValidateStages(names); err != nil {
+		return err
+	}
+
+	if f.Meta == nil {
+		f.Meta = &ConfigMeta{}
+	}
+
+	stages := slices.Clone(names)
+	slices.Sort(stages)
+
+	f.Meta.Stages = slices.Compact(stages)
+
+	return nil
+}
+
+// Stages returns the optional FAST stages deployed with the foundation
+func (f *FastConfig) Stages() []string {
+	if f.Meta == nil {
+		return nil
+	}
+
+	return f.Meta.Stages
 }
 
 func (f *FastConfig) SetPrefix(p string) error {
-	if i := strings.Count(p, ""); i > 10 {
-		err := errors.New("too many characters in prefix")
+	if err := ValidatePrefix(p); err != nil {
 		return err
 	}
 
@@ -92,18 +185,21 @@ func (f *FastConfig) SetPrefix(p string) error {
 	return nil
 }
 
-func (f *FastConfig) SetLogSinks(prefix string, sinks LogSinks) {
+// SetLogSinks validates the sinks and prefixes their names
+func (f *FastConfig) SetLogSinks(prefix string, sinks LogSinks) error {
+	if err := sinks.Validate(); err != nil {
+		return err
+	}
+
 	updatedLogSinks := make(LogSinks)
 
 	for k, v := range sinks {
-		updatedLogSink := make(LogSink)
-		for m, n := range v {
-			updatedLogSink[m] = n
-		}
-		updatedLogSinks[prefix+k] = updatedLogSink
+		updatedLogSinks[prefixSinkName(prefix, k)] = v
 	}
 
 	f.LogSinks = updatedLogSinks
+
+	return nil
 }
 
 // TODO: update to support various field types in struct
@@ -158,8 +254,59 @@ func (f *FastConfig) AddIamMember(policies []*IamAdditive) error {
 	return nil
 }
 
+// Marshal renders the config as it is written to the tfvars file, with
+// the keys pasture does not know kept as they were read
+func (f *FastConfig) Marshal() ([]byte, error) {
+	if len(f.Extra) == 0 {
+		return json.MarshalIndent(f, "", "    ")
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	for k, v := range f.Extra {
+		if _, ok := doc[k]; !ok {
+			doc[k] = v
+		}
+	}
+
+	return json.MarshalIndent(doc, "", "    ")
+}
+
+// SetVersions records the FAST and seed versions the config was built for
+func (f *FastConfig) SetVersions(fast string, seed string) {
+	if f.Meta == nil {
+		f.Meta = &ConfigMeta{}
+	}
+
+	f.Meta.FastVersion = fast
+	f.Meta.SeedVersion = seed
+}
+
+// SetSeedPath records the local working tree the seeds are linked from, in
+// place of a seed version
+func (f *FastConfig) SetSeedPath(dir string) {
+	if f.Meta == nil {
+		f.Meta = &ConfigMeta{}
+	}
+
+	f.Meta.SeedPath = dir
+
+	if dir != "" {
+		f.Meta.SeedVersion = ""
+	}
+}
+
+// WriteConfig writes the config and its schema metadata sidecar
 func (f *FastConfig) WriteConfig(filePath string) error {
-	j, err := json.MarshalIndent(f, "", "    ")
+	j, err := f.Marshal()
 
 	if err != nil {
 		return err
@@ -169,9 +316,22 @@ func (f *FastConfig) WriteConfig(filePath string) error {
 		return err
 	}
 
-	return nil
+	if f.Meta == nil {
+		f.Meta = &ConfigMeta{}
+	}
+
+	f.Meta.SchemaVersion = ConfigSchemaVersion
+
+	m, err := json.MarshalIndent(f.Meta, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return utils.CreateFile(metaPath(filePath), m, true)
 }
 
+// ReadConfig reads and validates the config, migrating configs written
+// with an older schema in memory only. MigrateConfig saves the result.
 func (f *FastConfig) ReadConfig(filePath string) error {
 	bytes, err := utils.ReadFile(filePath)
 
@@ -179,9 +339,65 @@ func (f *FastConfig) ReadConfig(filePath string) error {
 		return err
 	}
 
-	if err := json.Unmarshal(bytes, &f); err != nil {
+	meta, err := readMeta(filePath)
+	if err != nil {
 		return err
 	}
 
+	migrated, err := decodeConfig(bytes, meta.SchemaVersion, f)
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", filePath, err)
+	}
+
+	f.Meta = meta
+
+	if migrated {
+		logging.Info(
+			"config is migrated in memory - run pasture config migrate to save it",
+			"file", filePath,
+		)
+	}
+
 	return nil
 }
+
+// Outdated reports whether the config was read from an older schema
+func (f *FastConfig) Outdated() bool {
+	return f.Meta == nil || f.Meta.SchemaVersion < ConfigSchemaVersion
+}
+
+// MigrateConfig saves a config read from an older schema in the current
+// one, so terraform reads the migrated variables. It reports whether the
+// file was rewritten.
+func (f *FastConfig) MigrateConfig(filePath string) (bool, error) {
+	if !f.Outdated() {
+		return false, nil
+	}
+
+	return true, f.WriteConfig(filePath)
+}
+
+// readMeta reads the schema metadata, treating a missing sidecar as a
+// config written before versioning
+func readMeta(filePath string) (*ConfigMeta, error) {
+	meta := &ConfigMeta{}
+
+	bytes, err := utils.ReadFile(metaPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bytes, meta); err != nil {
+		return nil, fmt.Errorf(
+			"invalid config metadata %s: %w",
+			metaPath(filePath),
+			err,
+		)
+	}
+
+	return meta, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// DiffConfig lists the fields that differ between two configurations,
+// keyed by their dotted tfvars path
+func DiffConfig(current *FastConfig, updated *FastConfig) ([]ConfigChange, error) {
+	before, err := flattenConfig(current)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := flattenConfig(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	changes := make([]ConfigChange, 0)
+
+	for k := range keys {
+		if before[k] != after[k] {
+			changes = append(changes, ConfigChange{
+				Key: k,
+				Old: before[k],
+				New: after[k],
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes, nil
+}
+
+// flattenConfig maps every leaf of the tfvars document to its JSON value
+func flattenConfig(f *FastConfig) (map[string]string, error) {
+	var doc map[string]any
+
+	// keys pasture does not know are compared too
+	j, err := f.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(j, &doc); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	flatten("", doc, flat)
+
+	return flat, nil
+}
+
+func flatten(key string, v any, flat map[string]string) {
+	// unset values and empty objects are left out so they diff as missing
+	if v == nil {
+		return
+	}
+
+	if m, ok := v.(map[string]any); ok {
+		for k, child := range m {
+			if key != "" {
+				k = key + "." + k
+			}
+			flatten(k, child, flat)
+		}
+		return
+	}
+
+	j, _ := json.Marshal(v)
+	flat[key] = string(j)
+}
@@ -17,7 +17,13 @@ limitations under the License.
 package fabric
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"gopkg.in/yaml.v3"
@@ -30,54 +36,404 @@ func NewRoleFactory(path string) *RoleFactory {
 	}
 }
 
+func (f *RoleFactory) Target() string {
+	return f.Path
+}
+
+// ApplyFactory prefixes the custom role names of the pristine factory
+// files, so re-running it or changing the prefix never stacks prefixes
 func (f *RoleFactory) ApplyFactory(prefix string) error {
+	return applyFactory(f.Name, f.Path, prefix, func() ([]string, error) {
+		return f.prefixRoles(prefix)
+	})
+}
+
+func (f *RoleFactory) RevertFactory() error {
+	return revertFactory(f.Name, f.Path)
+}
+
+func (f *RoleFactory) Applied() (*FactoryRecord, error) {
+	return appliedFactory(f.Name, f.Path)
+}
+
+func (f *RoleFactory) prefixRoles(prefix string) ([]string, error) {
+	changed := make([]string, 0)
+
 	factoryFiles, err := os.ReadDir(f.Path)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, file := range factoryFiles {
 		var r yaml.Node
+		var updated bool
 
 		// read the file
 		p := f.Path + "/" + file.Name()
 		inBytes, err := utils.ReadFile(p)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// load file data into struct
 		if err := yaml.Unmarshal(inBytes, &r); err != nil {
-			return err
+			return nil, err
 		}
 
 		// update name property
 		for i, d := range r.Content {
 			// loop thru the nodes
 			for x := 0; x < len(d.Content); x += 2 {
-				// find the name property
-				if d.Content[x].Value == "name" {
-					// set the new name in the top level struct
-					oldValue := d.Content[x+1].Value
-					r.Content[i].Content[x+1].Value = prefix + "_" + oldValue
+				// find the name property; files are pristine, so upstream
+				// names that happen to start with the prefix get it too
+				if d.Content[x].Value != "name" {
+					continue
 				}
+
+				// set the new name in the top level struct
+				r.Content[i].Content[x+1].Value = prefix + "_" + d.Content[x+1].Value
+				updated = true
 			}
 		}
 
+		if !updated {
+			continue
+		}
+
 		// marshal new data to bytes
 		outBytes, err := yaml.Marshal(&r)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// write the updated yaml file
 		if err := utils.CreateFile(p, outBytes, true); err != nil {
-			return err
+			return nil, err
+		}
+
+		changed = append(changed, p)
+	}
+
+	return changed, nil
+}
+
+const (
+	orgPolicyDir     = "data/org-policies"
+	orgPolicyFile    = "pastures.yaml"
+	firewallRuleFile = "data/hierarchical-ingress-rules.yaml"
+)
+
+// OrgPolicyPresets are the built-in org policy overlays that relax FAST
+// defaults commonly in the way of a PoC
+var OrgPolicyPresets = map[string]string{
+	"allow-external-ip": `compute.vmExternalIpAccess:
+  rules:
+    - allow:
+        all: true
+`,
+	"allow-sa-keys": `iam.disableServiceAccountKeyCreation:
+  rules:
+    - enforce: false
+iam.disableServiceAccountKeyUpload:
+  rules:
+    - enforce: false
+`,
+}
+
+// FirewallPresets are the built-in hierarchical firewall rule overlays
+var FirewallPresets = map[string]string{
+	"allow-rdp-from-iap": `allow-rdp-from-iap:
+  description: Enable RDP from IAP
+  priority: 1003
+  enable_logging: true
+  match:
+    source_ranges:
+      - 35.235.240.0/20
+    layer4_configs:
+      - protocol: tcp
+        ports: ["3389"]
+`,
+}
+
+// NewOrgPolicyFactory loads the org policy overlays, each a preset name
+// or the path of a YAML file, for the bootstrap stage at path
+func NewOrgPolicyFactory(path string, overlays []string) (*OrgPolicyFactory, error) {
+	overlay, err := loadOverlay(OrgPolicyPresets, overlays)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OrgPolicyFactory{
+		Name:    "org-policies",
+		Path:    filepath.Join(path, orgPolicyDir),
+		Overlay: overlay,
+	}, nil
+}
+
+func (f *OrgPolicyFactory) Target() string {
+	return f.Path
+}
+
+// ApplyFactory moves the policies of the overlay out of the FAST files and
+// into a file of their own, so each policy is only defined once
+func (f *OrgPolicyFactory) ApplyFactory(prefix string) error {
+	return applyFactory(f.Name, f.Path, prefix, f.overlayPolicies)
+}
+
+func (f *OrgPolicyFactory) RevertFactory() error {
+	return revertFactory(f.Name, f.Path)
+}
+
+func (f *OrgPolicyFactory) Applied() (*FactoryRecord, error) {
+	return appliedFactory(f.Name, f.Path)
+}
+
+func (f *OrgPolicyFactory) overlayPolicies() ([]string, error) {
+	changed := make([]string, 0)
+
+	factoryFiles, err := os.ReadDir(f.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := mappingKeys(f.Overlay)
+
+	for _, file := range factoryFiles {
+		if file.IsDir() || file.Name() == orgPolicyFile {
+			continue
+		}
+
+		p := filepath.Join(f.Path, file.Name())
+
+		doc, err := readYamlMapping(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !removeMappingKeys(doc.Content[0], keys) {
+			continue
+		}
+
+		if err := writeYaml(p, doc); err != nil {
+			return nil, err
+		}
+
+		changed = append(changed, p)
+	}
+
+	p := filepath.Join(f.Path, orgPolicyFile)
+	if err := writeYaml(p, f.Overlay); err != nil {
+		return nil, err
+	}
+
+	return append(changed, p), nil
+}
+
+// NewFirewallFactory loads the firewall rule overlays, each a preset name
+// or the path of a YAML file, for the networking stage at path
+func NewFirewallFactory(path string, overlays []string) (*FirewallFactory, error) {
+	overlay, err := loadOverlay(FirewallPresets, overlays)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FirewallFactory{
+		Name:    "hierarchical-firewall",
+		Path:    filepath.Join(path, firewallRuleFile),
+		Overlay: overlay,
+	}, nil
+}
+
+func (f *FirewallFactory) Target() string {
+	return f.Path
+}
+
+// ApplyFactory replaces the rules of the FAST hierarchical policy that the
+// overlay redefines and adds the others
+func (f *FirewallFactory) ApplyFactory(prefix string) error {
+	return applyFactory(f.Name, f.Path, prefix, f.overlayRules)
+}
+
+func (f *FirewallFactory) RevertFactory() error {
+	return revertFactory(f.Name, f.Path)
+}
+
+func (f *FirewallFactory) Applied() (*FactoryRecord, error) {
+	return appliedFactory(f.Name, f.Path)
+}
+
+func (f *FirewallFactory) overlayRules() ([]string, error) {
+	doc, err := readYamlMapping(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := f.Overlay.Content[0].Content
+	for i := 0; i < len(rules); i += 2 {
+		setMappingKey(doc.Content[0], rules[i], rules[i+1])
+	}
+
+	if err := writeYaml(f.Path, doc); err != nil {
+		return nil, err
+	}
+
+	return []string{f.Path}, nil
+}
+
+// loadOverlay merges the named presets and YAML files into one mapping,
+// with later overlays winning
+func loadOverlay(presets map[string]string, names []string) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	for _, n := range names {
+		var doc yaml.Node
+
+		preset, ok := presets[n]
+		data := []byte(preset)
+
+		if !ok {
+			b, err := utils.ReadFile(n)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"overlay %s is neither a file nor a preset (%s): %w",
+					n, strings.Join(PresetNames(presets), ", "), err,
+				)
+			}
+
+			data = b
+		}
+
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("overlay %s: %w", n, err)
+		}
+
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		m := doc.Content[0]
+		if m.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("overlay %s: must be a YAML mapping", n)
+		}
+
+		for i := 0; i < len(m.Content); i += 2 {
+			setMappingKey(root, m.Content[i], m.Content[i+1])
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// PresetNames returns the sorted names of overlay presets
+func PresetNames(presets map[string]string) []string {
+	names := make([]string, 0, len(presets))
+
+	for n := range presets {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// readYamlMapping reads a YAML document whose root is a mapping. An empty
+// file reads as an empty mapping.
+func readYamlMapping(p string) (*yaml.Node, error) {
+	var doc yaml.Node
+
+	b, err := utils.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
 		}
 	}
 
-	return nil
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: must be a YAML mapping", p)
+	}
+
+	return &doc, nil
+}
+
+func writeYaml(p string, doc *yaml.Node) error {
+	b, err := marshalYaml(doc)
+	if err != nil {
+		return err
+	}
+
+	return utils.CreateFile(p, b, true)
+}
+
+// marshalYaml encodes with the two space indent of the FAST data files
+func marshalYaml(doc *yaml.Node) ([]byte, error) {
+	var b bytes.Buffer
+
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func mappingKeys(doc *yaml.Node) []string {
+	keys := make([]string, 0)
+
+	m := doc.Content[0].Content
+	for i := 0; i < len(m); i += 2 {
+		keys = append(keys, m[i].Value)
+	}
+
+	return keys
+}
+
+// setMappingKey replaces the value of a key, or appends the key
+func setMappingKey(m *yaml.Node, key *yaml.Node, value *yaml.Node) {
+	for i := 0; i < len(m.Content); i += 2 {
+		if m.Content[i].Value == key.Value {
+			m.Content[i+1] = value
+			return
+		}
+	}
+
+	m.Content = append(m.Content, key, value)
+}
+
+// removeMappingKeys reports whether any of the keys were removed
+func removeMappingKeys(m *yaml.Node, keys []string) bool {
+	removed := false
+	content := make([]*yaml.Node, 0, len(m.Content))
+
+	for i := 0; i < len(m.Content); i += 2 {
+		if slices.Contains(keys, m.Content[i].Value) {
+			removed = true
+			continue
+		}
+
+		content = append(content, m.Content[i], m.Content[i+1])
+	}
+
+	m.Content = content
+
+	return removed
 }
@@ -0,0 +1,162 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOrgPolicyFactory(t *testing.T) {
+	upstream := map[string]string{
+		"compute.yaml": `compute.skipDefaultNetworkCreation:
+  rules:
+    - enforce: true
+compute.vmExternalIpAccess:
+  rules:
+    - deny:
+        all: true
+`,
+		"iam.yaml": `iam.disableServiceAccountKeyCreation:
+  rules:
+    - enforce: true
+`,
+	}
+
+	tests := []struct {
+		name     string
+		earlier  []string
+		overlays []string
+		want     map[string][]string
+	}{
+		{
+			name:     "preset",
+			overlays: []string{"allow-external-ip"},
+			want: map[string][]string{
+				"compute.yaml":  {"compute.skipDefaultNetworkCreation"},
+				"iam.yaml":      {"iam.disableServiceAccountKeyCreation"},
+				"pastures.yaml": {"compute.vmExternalIpAccess"},
+			},
+		},
+		{
+			name:     "several presets",
+			overlays: []string{"allow-external-ip", "allow-sa-keys"},
+			want: map[string][]string{
+				"compute.yaml": {"compute.skipDefaultNetworkCreation"},
+				"iam.yaml":     {},
+				"pastures.yaml": {
+					"compute.vmExternalIpAccess",
+					"iam.disableServiceAccountKeyCreation",
+					"iam.disableServiceAccountKeyUpload",
+				},
+			},
+		},
+		{
+			name:     "applied again from the pristine copy",
+			earlier:  []string{"allow-external-ip"},
+			overlays: []string{"allow-sa-keys"},
+			want: map[string][]string{
+				"compute.yaml": {
+					"compute.skipDefaultNetworkCreation",
+					"compute.vmExternalIpAccess",
+				},
+				"iam.yaml": {},
+				"pastures.yaml": {
+					"iam.disableServiceAccountKeyCreation",
+					"iam.disableServiceAccountKeyUpload",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage := t.TempDir()
+			writeTestFiles(t, filepath.Join(stage, orgPolicyDir), upstream)
+
+			if tt.earlier != nil {
+				f, err := NewOrgPolicyFactory(stage, tt.earlier)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := f.ApplyFactory("abc"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := NewOrgPolicyFactory(stage, tt.overlays)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.ApplyFactory("abc"); err != nil {
+				t.Fatalf("ApplyFactory() error = %v", err)
+			}
+
+			for name, want := range tt.want {
+				doc, err := readYamlMapping(filepath.Join(f.Path, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := mappingKeys(doc)
+				slices.Sort(got)
+
+				if !slices.Equal(got, want) {
+					t.Errorf("%s policies = %v, want %v", name, got, want)
+				}
+			}
+
+			r, err := f.Applied()
+			if err != nil || r == nil {
+				t.Fatalf("Applied() = %v, %v after ApplyFactory", r, err)
+			}
+
+			if r.Prefix != "abc" || !slices.Contains(r.Files, filepath.Join(f.Path, orgPolicyFile)) {
+				t.Errorf("Applied() = %+v", r)
+			}
+
+			if err := f.RevertFactory(); err != nil {
+				t.Fatalf("RevertFactory() error = %v", err)
+			}
+
+			for name, want := range upstream {
+				got, err := os.ReadFile(filepath.Join(f.Path, name))
+				if err != nil || string(got) != want {
+					t.Errorf("RevertFactory() left %s = %q, %v", name, got, err)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(f.Path, orgPolicyFile)); err == nil {
+				t.Errorf("RevertFactory() kept %s", orgPolicyFile)
+			}
+
+			if r, err := f.Applied(); err != nil || r != nil {
+				t.Errorf("Applied() = %v, %v after RevertFactory", r, err)
+			}
+		})
+	}
+}
+
+func TestOrgPolicyFactoryUnknownOverlay(t *testing.T) {
+	if _, err := NewOrgPolicyFactory(t.TempDir(), []string{"allow-everything"}); err == nil {
+		t.Errorf("NewOrgPolicyFactory() accepted an unknown overlay")
+	}
+}
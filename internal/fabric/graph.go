@@ -0,0 +1,246 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// NewGraph builds the dependency graph of the stages. Every prerequisite
+// must be one of the stages, and the prerequisites must not form a cycle.
+func NewGraph(stages []*Stage) (*Graph, error) {
+	g := &Graph{
+		stages: stages,
+		index:  make(map[string]*Stage),
+	}
+
+	for _, s := range stages {
+		if _, ok := g.index[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate stage %s", s.Name)
+		}
+
+		g.index[s.Name] = s
+	}
+
+	for _, s := range stages {
+		for _, r := range s.Requires {
+			if _, ok := g.index[r]; !ok {
+				return nil, fmt.Errorf(
+					"stage %s requires unknown stage %s", s.Name, r,
+				)
+			}
+		}
+	}
+
+	if _, err := g.Levels(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Levels groups the stages into waves that only depend on earlier waves.
+// Stages keep the order they were added in within a wave.
+func (g *Graph) Levels() ([][]*Stage, error) {
+	levels := make([][]*Stage, 0)
+	done := make(map[string]bool)
+
+	for len(done) < len(g.stages) {
+		level := make([]*Stage, 0)
+
+		for _, s := range g.stages {
+			if done[s.Name] {
+				continue
+			}
+
+			ready := !slices.ContainsFunc(s.Requires, func(r string) bool {
+				return !done[r]
+			})
+
+			if ready {
+				level = append(level, s)
+			}
+		}
+
+		if len(level) == 0 {
+			return nil, fmt.Errorf(
+				"stage dependency cycle between %s",
+				strings.Join(g.pending(done), ", "),
+			)
+		}
+
+		for _, s := range level {
+			done[s.Name] = true
+		}
+
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// Order returns the stages in execution order, or in the reverse order
+// for destroy
+func (g *Graph) Order(reverse bool) []*Stage {
+	levels, _ := g.Levels()
+	order := make([]*Stage, 0)
+
+	for _, l := range levels {
+		order = append(order, l...)
+	}
+
+	if reverse {
+		slices.Reverse(order)
+	}
+
+	return order
+}
+
+// Roots returns the stages without prerequisites
+func (g *Graph) Roots() []*Stage {
+	roots := make([]*Stage, 0)
+
+	for _, s := range g.stages {
+		if len(s.Requires) == 0 {
+			roots = append(roots, s)
+		}
+	}
+
+	return roots
+}
+
+// Run calls fn for every stage once its prerequisites have completed, or,
+// in reverse, once every stage that requires it has. Stages of a wave run
+// concurrently, and the first wave with a failure ends the run after all
+// of its stages have returned.
+func (g *Graph) Run(reverse bool, fn func(*Stage) error) error {
+	levels, err := g.Levels()
+	if err != nil {
+		return err
+	}
+
+	if reverse {
+		slices.Reverse(levels)
+	}
+
+	for _, level := range levels {
+		var wg sync.WaitGroup
+
+		errs := make([]error, len(level))
+
+		for i, s := range level {
+			wg.Add(1)
+
+			go func(i int, s *Stage) {
+				defer wg.Done()
+				errs[i] = fn(s)
+			}(i, s)
+		}
+
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Text renders the waves of the graph and the stages each one waits for
+func (g *Graph) Text(reverse bool) string {
+	var b strings.Builder
+
+	levels, _ := g.Levels()
+	if reverse {
+		slices.Reverse(levels)
+	}
+
+	for i, l := range levels {
+		fmt.Fprintf(&b, "Wave %d:\n", i+1)
+
+		for _, s := range l {
+			fmt.Fprintf(&b, "  %s (%s)", s.Name, s.Type)
+
+			after := s.Requires
+			if reverse {
+				after = g.dependents(s.Name)
+			}
+
+			if len(after) > 0 {
+				fmt.Fprintf(&b, " after %s", strings.Join(after, ", "))
+			}
+
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// DOT renders the graph in the Graphviz DOT language, with edges pointing
+// from a prerequisite to the stages that require it
+func (g *Graph) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph pasture {\n")
+	b.WriteString("    rankdir=LR;\n")
+
+	for _, s := range g.stages {
+		fmt.Fprintf(&b, "    %q [shape=box, label=%q];\n", s.Name, s.Name+"\n"+s.Type)
+	}
+
+	for _, s := range g.stages {
+		for _, r := range s.Requires {
+			fmt.Fprintf(&b, "    %q -> %q;\n", r, s.Name)
+		}
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// dependents lists the stages that require the named stage
+func (g *Graph) dependents(name string) []string {
+	names := make([]string, 0)
+
+	for _, s := range g.stages {
+		if slices.Contains(s.Requires, name) {
+			names = append(names, s.Name)
+		}
+	}
+
+	return names
+}
+
+// pending lists the stages that have not been ordered yet
+func (g *Graph) pending(done map[string]bool) []string {
+	names := make([]string, 0)
+
+	for _, s := range g.stages {
+		if !done[s.Name] {
+			names = append(names, s.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,259 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testStage(name string, requires ...string) *Stage {
+	return &Stage{Name: name, Type: "foundation", Requires: requires}
+}
+
+func stageNames(stages []*Stage) []string {
+	n := make([]string, len(stages))
+	for i, s := range stages {
+		n[i] = s.Name
+	}
+
+	return n
+}
+
+func TestNewGraphErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []*Stage
+		want   string
+	}{
+		{
+			name:   "cycle",
+			stages: []*Stage{testStage("a"), testStage("b", "a", "c"), testStage("c", "b")},
+			want:   "cycle between b, c",
+		},
+		{
+			name:   "self cycle",
+			stages: []*Stage{testStage("a", "a")},
+			want:   "cycle between a",
+		},
+		{
+			name:   "unknown prerequisite",
+			stages: []*Stage{testStage("a", "z")},
+			want:   "requires unknown stage z",
+		},
+		{
+			name:   "duplicate",
+			stages: []*Stage{testStage("a"), testStage("a")},
+			want:   "duplicate stage a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGraph(tt.stages)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewGraph() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphLevels(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []*Stage
+		want   [][]string
+	}{
+		{
+			name:   "empty",
+			stages: []*Stage{},
+			want:   [][]string{},
+		},
+		{
+			name: "chain",
+			stages: []*Stage{
+				testStage("0-bootstrap"),
+				testStage("1-resman", "0-bootstrap"),
+				testStage("data-cloud", "1-resman"),
+			},
+			want: [][]string{{"0-bootstrap"}, {"1-resman"}, {"data-cloud"}},
+		},
+		{
+			name: "independent stages share a wave in insertion order",
+			stages: []*Stage{
+				testStage("0-bootstrap"),
+				testStage("1-resman", "0-bootstrap"),
+				testStage("3-security", "1-resman"),
+				testStage("2-networking", "1-resman"),
+				testStage("data-cloud", "2-networking", "3-security"),
+			},
+			want: [][]string{
+				{"0-bootstrap"},
+				{"1-resman"},
+				{"3-security", "2-networking"},
+				{"data-cloud"},
+			},
+		},
+		{
+			name:   "prerequisite added after its dependent",
+			stages: []*Stage{testStage("b", "a"), testStage("a")},
+			want:   [][]string{{"a"}, {"b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGraph(tt.stages)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			levels, err := g.Levels()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([][]string, len(levels))
+			for i, l := range levels {
+				got[i] = stageNames(l)
+			}
+
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("Levels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphOrder(t *testing.T) {
+	g, err := NewGraph([]*Stage{testStage("c", "b"), testStage("a"), testStage("b", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := stageNames(g.Order(false)); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("Order(false) = %v", got)
+	}
+
+	if got := stageNames(g.Order(true)); !slices.Equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("Order(true) = %v", got)
+	}
+}
+
+func TestGraphRun(t *testing.T) {
+	stages := []*Stage{
+		testStage("a"),
+		testStage("b", "a"),
+		testStage("c", "a"),
+		testStage("d", "b", "c"),
+	}
+
+	tests := []struct {
+		name    string
+		reverse bool
+		fail    string
+		want    [][]string
+	}{
+		{
+			name: "forward",
+			want: [][]string{{"a"}, {"b", "c"}, {"d"}},
+		},
+		{
+			name:    "reverse",
+			reverse: true,
+			want:    [][]string{{"d"}, {"b", "c"}, {"a"}},
+		},
+		{
+			name: "failure completes its wave and stops",
+			fail: "b",
+			want: [][]string{{"a"}, {"b", "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGraph(stages)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			ran := make(map[string]bool)
+			got := make([][]string, 0)
+
+			// a stage may only start once the wave before it is complete
+			levels, _ := g.Levels()
+			if tt.reverse {
+				slices.Reverse(levels)
+			}
+
+			wave := func(name string) int {
+				for i, l := range levels {
+					if slices.Contains(stageNames(l), name) {
+						return i
+					}
+				}
+
+				return -1
+			}
+
+			errFail := errors.New("failed")
+
+			err = g.Run(tt.reverse, func(s *Stage) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				w := wave(s.Name)
+				for _, prev := range levels[:w] {
+					for _, p := range prev {
+						if !ran[p.Name] {
+							t.Errorf("%s started before %s", s.Name, p.Name)
+						}
+					}
+				}
+
+				ran[s.Name] = true
+
+				for len(got) <= w {
+					got = append(got, []string{})
+				}
+
+				got[w] = append(got[w], s.Name)
+				slices.Sort(got[w])
+
+				if s.Name == tt.fail {
+					return errFail
+				}
+
+				return nil
+			})
+
+			if tt.fail != "" && !errors.Is(err, errFail) {
+				t.Errorf("Run() error = %v, want %v", err, errFail)
+			} else if tt.fail == "" && err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("Run() waves = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value at a dotted key such as locations.gcs. Keys follow
+// the tfvars JSON names; map keys that contain dots, like IAM roles, are
+// taken from the rest of the key.
+func (f *FastConfig) Get(key string) (any, error) {
+	v, err := getPath(reflect.ValueOf(f).Elem(), splitKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return v.Interface(), nil
+}
+
+// Set parses value as the type of the field at a dotted key and stores it.
+// Lists accept comma separated values; objects must be given as JSON.
+func (f *FastConfig) Set(key string, value string) error {
+	if err := setPath(reflect.ValueOf(f).Elem(), splitKey(key), value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	return nil
+}
+
+func splitKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+
+	return strings.Split(key, ".")
+}
+
+func getPath(v reflect.Value, path []string) (reflect.Value, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, fmt.Errorf("not set")
+		}
+		v = v.Elem()
+	}
+
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		f, err := structField(v, path[0])
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		return getPath(f, path[1:])
+	case reflect.Map:
+		k, rest := mapKey(v.Type(), path)
+
+		e := v.MapIndex(reflect.ValueOf(k))
+		if !e.IsValid() {
+			return reflect.Value{}, fmt.Errorf("%q not set", k)
+		}
+
+		return getPath(e, rest)
+	default:
+		return reflect.Value{}, fmt.Errorf("%s has no field %q", v.Type(), path[0])
+	}
+}
+
+func setPath(v reflect.Value, path []string, raw string) error {
+	if len(path) == 0 {
+		p, err := parseValue(v.Type(), raw)
+		if err != nil {
+			return err
+		}
+
+		v.Set(p)
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return setPath(v.Elem(), path, raw)
+	case reflect.Struct:
+		f, err := structField(v, path[0])
+		if err != nil {
+			return err
+		}
+
+		return setPath(f, path[1:], raw)
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		k, rest := mapKey(v.Type(), path)
+		key := reflect.ValueOf(k).Convert(v.Type().Key())
+
+		// map elements are not addressable, so update a copy
+		e := reflect.New(v.Type().Elem()).Elem()
+		if cur := v.MapIndex(key); cur.IsValid() {
+			e.Set(cur)
+		}
+
+		if err := setPath(e, rest, raw); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, e)
+
+		return nil
+	default:
+		return fmt.Errorf("%s has no field %q", v.Type(), path[0])
+	}
+}
+
+// structField finds a field by its JSON name
+func structField(v reflect.Value, name string) (reflect.Value, error) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == name {
+			return v.Field(i), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("%s has no field %q", t, name)
+}
+
+// mapKey splits off the map key. Maps of objects use a single segment;
+// otherwise the whole remainder is the key.
+func mapKey(t reflect.Type, path []string) (string, []string) {
+	e := t.Elem()
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+
+	if e.Kind() == reflect.Map || e.Kind() == reflect.Struct {
+		return path[0], path[1:]
+	}
+
+	return strings.Join(path, "."), nil
+}
+
+func parseValue(t reflect.Type, raw string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return v, fmt.Errorf("expected true or false, got %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("expected an integer, got %q", raw)
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String && !strings.HasPrefix(raw, "[") {
+			items := make([]string, 0)
+			for _, i := range strings.Split(raw, ",") {
+				if i = strings.TrimSpace(i); i != "" {
+					items = append(items, i)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(t))
+			break
+		}
+		fallthrough
+	default:
+		if err := json.Unmarshal([]byte(raw), v.Addr().Interface()); err != nil {
+			return v, fmt.Errorf("expected JSON for %s: %w", t, err)
+		}
+	}
+
+	return v, nil
+}
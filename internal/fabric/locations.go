@@ -0,0 +1,206 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// MultiRegions are the multi-regions offered for --location
+	MultiRegions = []string{"US", "EU", "ASIA"}
+
+	bqMultiRegions  = []string{"US", "EU"}
+	gcsMultiRegions = []string{
+		"US", "EU", "ASIA",
+		"ASIA1", "EUR4", "EUR5", "EUR7", "EUR8", "NAM4",
+	}
+	loggingMultiRegions = []string{"global", "us", "eu"}
+
+	// bqRegions place BigQuery in a region for the multi-regions it does
+	// not offer, as the asia residency does
+	bqRegions = map[string]string{"ASIA": "asia-southeast1"}
+
+	regions = []string{
+		"africa-south1",
+		"asia-east1", "asia-east2",
+		"asia-northeast1", "asia-northeast2", "asia-northeast3",
+		"asia-south1", "asia-south2",
+		"asia-southeast1", "asia-southeast2",
+		"australia-southeast1", "australia-southeast2",
+		"europe-central2", "europe-north1", "europe-southwest1",
+		"europe-west1", "europe-west2", "europe-west3", "europe-west4",
+		"europe-west6", "europe-west8", "europe-west9", "europe-west10",
+		"europe-west12",
+		"me-central1", "me-central2", "me-west1",
+		"northamerica-northeast1", "northamerica-northeast2",
+		"southamerica-east1", "southamerica-west1",
+		"us-central1", "us-east1", "us-east4", "us-east5", "us-south1",
+		"us-west1", "us-west2", "us-west3", "us-west4",
+	}
+
+	// Residencies keep every location and the seed region in one geography
+	Residencies = map[string]Residency{
+		"us": {
+			Name: "us",
+			Locations: Locations{
+				Bq:      "US",
+				Gcs:     "US",
+				Logging: "us",
+				PubSub:  []string{"us-central1"},
+			},
+			Region:         "us-central1",
+			RegionPrefixes: []string{"us-", "northamerica-"},
+		},
+		"eu": {
+			Name: "eu",
+			Locations: Locations{
+				Bq:      "EU",
+				Gcs:     "EU",
+				Logging: "eu",
+				PubSub:  []string{"europe-west1"},
+			},
+			Region:         "europe-west1",
+			RegionPrefixes: []string{"europe-"},
+		},
+		"asia": {
+			Name: "asia",
+			Locations: Locations{
+				Bq:      "asia-southeast1",
+				Gcs:     "ASIA",
+				Logging: "asia-southeast1",
+				PubSub:  []string{"asia-southeast1"},
+			},
+			Region:         "asia-southeast1",
+			RegionPrefixes: []string{"asia-"},
+		},
+	}
+)
+
+// NewLocations places BigQuery and GCS in a multi-region, with global
+// logging and no Pub/Sub restriction. BigQuery goes to a region of
+// multi-regions it does not have.
+func NewLocations(multiRegion string) *Locations {
+	bq := multiRegion
+	if r, ok := bqRegions[strings.ToUpper(multiRegion)]; ok {
+		bq = r
+	}
+
+	return &Locations{
+		Bq:      bq,
+		Gcs:     multiRegion,
+		Logging: "global",
+		PubSub:  []string{},
+	}
+}
+
+// GetResidency looks up a data residency preset
+func GetResidency(name string) (*Residency, error) {
+	r, ok := Residencies[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown residency %q - must be one of %s",
+			name,
+			strings.Join(residencyNames(), ", "),
+		)
+	}
+
+	// copy so callers can override single locations
+	r.Locations.PubSub = slices.Clone(r.Locations.PubSub)
+
+	return &r, nil
+}
+
+// AllowsRegion reports whether a region belongs to the residency
+func (r *Residency) AllowsRegion(region string) bool {
+	for _, p := range r.RegionPrefixes {
+		if strings.HasPrefix(region, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks every location is a known multi-region or region for
+// its service, normalizing the case of multi-regions
+func (l *Locations) Validate() error {
+	var errs []error
+
+	var err error
+	if l.Bq, err = location(l.Bq, bqMultiRegions); err != nil {
+		errs = append(errs, fmt.Errorf("locations.bq: %w", err))
+	}
+
+	if l.Gcs, err = location(l.Gcs, gcsMultiRegions); err != nil {
+		errs = append(errs, fmt.Errorf("locations.gcs: %w", err))
+	}
+
+	if l.Logging, err = location(l.Logging, loggingMultiRegions); err != nil {
+		errs = append(errs, fmt.Errorf("locations.logging: %w", err))
+	}
+
+	for i, p := range l.PubSub {
+		if l.PubSub[i], err = location(p, nil); err != nil {
+			errs = append(errs, fmt.Errorf("locations.pubsub: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateRegion checks a region is known
+func ValidateRegion(region string) error {
+	_, err := location(region, nil)
+	return err
+}
+
+func location(l string, multiRegions []string) (string, error) {
+	for _, m := range multiRegions {
+		if strings.EqualFold(l, m) {
+			return m, nil
+		}
+	}
+
+	if r := strings.ToLower(l); slices.Contains(regions, r) {
+		return r, nil
+	}
+
+	if len(multiRegions) > 0 {
+		return l, fmt.Errorf(
+			"unknown location %q - must be a region or one of %s",
+			l,
+			strings.Join(multiRegions, ", "),
+		)
+	}
+
+	return l, fmt.Errorf("unknown region %q", l)
+}
+
+func residencyNames() []string {
+	names := make([]string, 0, len(Residencies))
+	for n := range Residencies {
+		names = append(names, n)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewLocationsValid(t *testing.T) {
+	for _, m := range MultiRegions {
+		for _, name := range []string{m, strings.ToLower(m)} {
+			t.Run(name, func(t *testing.T) {
+				if err := NewLocations(name).Validate(); err != nil {
+					t.Errorf("NewLocations(%q).Validate() = %v", name, err)
+				}
+			})
+		}
+	}
+}
+
+func TestResidenciesValid(t *testing.T) {
+	for _, name := range residencyNames() {
+		t.Run(name, func(t *testing.T) {
+			r, err := GetResidency(strings.ToUpper(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.Locations.Validate(); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+
+			if err := ValidateRegion(r.Region); err != nil || !r.AllowsRegion(r.Region) {
+				t.Errorf("seed region %s is not a region of the residency", r.Region)
+			}
+
+			for _, p := range r.Locations.PubSub {
+				if !r.AllowsRegion(p) {
+					t.Errorf("Pub/Sub region %s is not a region of the residency", p)
+				}
+			}
+
+			// callers may change the locations of the copy they get
+			r.Locations.PubSub[0] = "changed"
+			if Residencies[name].Locations.PubSub[0] == "changed" {
+				t.Errorf("GetResidency() shares the preset Pub/Sub regions")
+			}
+		})
+	}
+}
+
+func TestLocationsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      Locations
+		want    Locations
+		wantErr []string
+	}{
+		{
+			name: "multi-regions are normalized",
+			in:   Locations{Bq: "eu", Gcs: "asia1", Logging: "EU", PubSub: []string{"Europe-West1"}},
+			want: Locations{Bq: "EU", Gcs: "ASIA1", Logging: "eu", PubSub: []string{"europe-west1"}},
+		},
+		{
+			name: "regions",
+			in:   Locations{Bq: "us-east1", Gcs: "us-east1", Logging: "us-east1", PubSub: []string{}},
+			want: Locations{Bq: "us-east1", Gcs: "us-east1", Logging: "us-east1", PubSub: []string{}},
+		},
+		{
+			name:    "BigQuery has no ASIA multi-region",
+			in:      Locations{Bq: "ASIA", Gcs: "ASIA", Logging: "global"},
+			wantErr: []string{"locations.bq"},
+		},
+		{
+			name:    "Pub/Sub takes regions only",
+			in:      Locations{Bq: "US", Gcs: "US", Logging: "us", PubSub: []string{"US"}},
+			wantErr: []string{"locations.pubsub"},
+		},
+		{
+			name:    "every unknown location is reported",
+			in:      Locations{Bq: "mars", Gcs: "mars", Logging: "mars"},
+			wantErr: []string{"locations.bq", "locations.gcs", "locations.logging"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.in
+			err := l.Validate()
+
+			if len(tt.wantErr) > 0 {
+				for _, key := range tt.wantErr {
+					if err == nil || !strings.Contains(err.Error(), key) {
+						t.Errorf("Validate() error = %v, want %s", err, key)
+					}
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if l.Bq != tt.want.Bq || l.Gcs != tt.want.Gcs || l.Logging != tt.want.Logging ||
+				!slices.Equal(l.PubSub, tt.want.PubSub) {
+				t.Errorf("Validate() = %+v, want %+v", l, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Overlay files live under overlays/<profile>/<stage>, mirroring the stage
+// directory. What was applied, and the files they replaced, is kept under
+// overlays/.applied/<profile>/<stage>.
+const (
+	overlayDir      = "overlays"
+	overlayStateDir = ".applied"
+	overlayBackups  = "backup"
+	overlayManifest = "manifest.json"
+
+	DefaultProfile = "default"
+)
+
+// NewOverlayFactory returns the overlay of a profile for a stage
+func NewOverlayFactory(
+	configPath string,
+	profile string,
+	stage *Stage,
+) *OverlayFactory {
+	return &OverlayFactory{
+		Name:      "overlay",
+		Path:      filepath.Join(configPath, overlayDir, profile, stage.Name),
+		StagePath: stage.Path,
+		StatePath: filepath.Join(
+			configPath, overlayDir, overlayStateDir, profile, stage.Name,
+		),
+	}
+}
+
+// OverlayProfiles lists the profiles with an overlay directory
+func OverlayProfiles(configPath string) ([]string, error) {
+	profiles := make([]string, 0)
+
+	entries, err := os.ReadDir(filepath.Join(configPath, overlayDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != overlayStateDir {
+			profiles = append(profiles, e.Name())
+		}
+	}
+
+	return profiles, nil
+}
+
+func (f *OverlayFactory) Target() string {
+	return f.Path
+}
+
+// Exists reports whether the profile has overlay files for the stage
+func (f *OverlayFactory) Exists() bool {
+	_, err := os.Stat(f.Path)
+
+	return err == nil
+}
+
+// Files lists the overlay files relative to the stage directory
+func (f *OverlayFactory) Files() ([]string, error) {
+	files := make([]string, 0)
+
+	if !f.Exists() {
+		return files, nil
+	}
+
+	err := filepath.WalkDir(f.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(f.Path, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, rel)
+
+		return nil
+	})
+
+	return files, err
+}
+
+// Render returns the content of a stage file with the overlay applied to
+// base, the content the file would have without the overlay
+func (f *OverlayFactory) Render(rel string, base []byte) ([]byte, error) {
+	overlay, err := os.ReadFile(filepath.Join(f.Path, rel))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeOverlay(rel, base, overlay)
+}
+
+// ApplyFactory reverts the files changed by the last run and writes the
+// overlay over the stage files, after any other factory has run
+func (f *OverlayFactory) ApplyFactory(prefix string) error {
+	if err := f.RevertFactory(); err != nil {
+		return err
+	}
+
+	files, err := f.Files()
+	if err != nil {
+		return err
+	}
+
+	manifest := make([]*OverlayFile, 0)
+
+	for _, rel := range files {
+		dst := filepath.Join(f.StagePath, rel)
+		entry := &OverlayFile{Path: rel}
+
+		base, err := os.ReadFile(dst)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			entry.Created = true
+		case err != nil:
+			return err
+		default:
+			backup := filepath.Join(f.StatePath, overlayBackups, rel)
+
+			if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+				return err
+			}
+
+			if err := utils.CreateFile(backup, base, true); err != nil {
+				return err
+			}
+		}
+
+		merged, err := f.Render(rel, base)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		if err := utils.CreateFile(dst, merged, true); err != nil {
+			return err
+		}
+
+		entry.Sum = checksum(merged)
+		manifest = append(manifest, entry)
+	}
+
+	if len(manifest) == 0 {
+		return nil
+	}
+
+	return f.writeManifest(manifest)
+}
+
+// RevertFactory puts back the stage files the overlay replaced. Files
+// that were reset since, by a factory or a fresh clone, are left alone.
+func (f *OverlayFactory) RevertFactory() error {
+	manifest, err := f.readManifest()
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	for _, entry := range manifest {
+		dst := filepath.Join(f.StagePath, entry.Path)
+
+		current, err := os.ReadFile(dst)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if checksum(current) != entry.Sum {
+			continue
+		}
+
+		if entry.Created {
+			if err := os.Remove(dst); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		backup := filepath.Join(f.StatePath, overlayBackups, entry.Path)
+		if err := utils.CopyPath(backup, dst); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(f.StatePath)
+}
+
+// Applied returns a record of the overlay files written by the last run
+func (f *OverlayFactory) Applied() (*FactoryRecord, error) {
+	manifest, err := f.readManifest()
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filepath.Join(f.StatePath, overlayManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	record := &FactoryRecord{
+		Name:    f.Name,
+		Target:  f.Path,
+		Applied: info.ModTime().UTC(),
+	}
+
+	for _, entry := range manifest {
+		record.Files = append(
+			record.Files,
+			filepath.Join(f.StagePath, entry.Path),
+		)
+	}
+
+	return record, nil
+}
+
+func (f *OverlayFactory) readManifest() ([]*OverlayFile, error) {
+	var manifest []*OverlayFile
+
+	data, err := os.ReadFile(filepath.Join(f.StatePath, overlayManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func (f *OverlayFactory) writeManifest(manifest []*OverlayFile) error {
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.StatePath, 0755); err != nil {
+		return err
+	}
+
+	return utils.CreateFile(
+		filepath.Join(f.StatePath, overlayManifest),
+		data,
+		true,
+	)
+}
+
+// mergeOverlay merges the top level keys of a YAML mapping overlay into
+// a YAML mapping base, where a null value removes the key. Any other
+// overlay replaces the base.
+func mergeOverlay(rel string, base []byte, overlay []byte) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(rel))
+	if len(base) == 0 || (ext != ".yaml" && ext != ".yml") {
+		return overlay, nil
+	}
+
+	var b, o yaml.Node
+
+	if err := yaml.Unmarshal(base, &b); err != nil {
+		return overlay, nil
+	}
+
+	if err := yaml.Unmarshal(overlay, &o); err != nil {
+		return nil, err
+	}
+
+	if len(b.Content) == 0 || len(o.Content) == 0 ||
+		b.Content[0].Kind != yaml.MappingNode ||
+		o.Content[0].Kind != yaml.MappingNode {
+		return overlay, nil
+	}
+
+	m := o.Content[0].Content
+	for i := 0; i < len(m); i += 2 {
+		if m[i+1].Tag == "!!null" {
+			removeMappingKeys(b.Content[0], []string{m[i].Value})
+			continue
+		}
+
+		setMappingKey(b.Content[0], m[i], m[i+1])
+	}
+
+	return marshalYaml(&b)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
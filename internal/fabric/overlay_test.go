@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeOverlay(t *testing.T) {
+	const base = `a:
+  rules:
+    - enforce: true
+b:
+  - x
+  - y
+c: 1
+`
+
+	tests := []struct {
+		name    string
+		rel     string
+		base    string
+		overlay string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "null removes the key",
+			rel:     "policies.yaml",
+			base:    base,
+			overlay: "a: null\nc: ~\n",
+			want:    "b: [x, y]\n",
+		},
+		{
+			name:    "value replaces the key whole",
+			rel:     "policies.yaml",
+			base:    base,
+			overlay: "a:\n  rules:\n    - allow:\n        all: true\nb: [z]\n",
+			want:    "a: {rules: [{allow: {all: true}}]}\nb: [z]\nc: 1\n",
+		},
+		{
+			name:    "new key is added",
+			rel:     "policies.yml",
+			base:    base,
+			overlay: "d: new\n",
+			want:    "a: {rules: [{enforce: true}]}\nb: [x, y]\nc: 1\nd: new\n",
+		},
+		{
+			name:    "null of a missing key",
+			rel:     "policies.yaml",
+			base:    base,
+			overlay: "d: null\n",
+			want:    base,
+		},
+		{
+			name:    "overlay that is not a mapping replaces the file",
+			rel:     "policies.yaml",
+			base:    base,
+			overlay: "- a\n",
+			want:    "- a\n",
+		},
+		{
+			name:    "new file",
+			rel:     "policies.yaml",
+			overlay: "a: null\n",
+			want:    "a: null\n",
+		},
+		{
+			name:    "file that is not YAML",
+			rel:     "main.tf",
+			base:    "a: 1\n",
+			overlay: "b: 2\n",
+			want:    "b: 2\n",
+		},
+		{
+			name:    "invalid overlay",
+			rel:     "policies.yaml",
+			base:    base,
+			overlay: "a: [\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeOverlay(tt.rel, []byte(tt.base), []byte(tt.overlay))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("mergeOverlay() = %q, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("mergeOverlay() error = %v", err)
+			}
+
+			var g, w any
+
+			if err := yaml.Unmarshal(got, &g); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := yaml.Unmarshal([]byte(tt.want), &w); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("mergeOverlay() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+)
+
+// Factories keep the upstream copy of the files they rewrite next to them,
+// along with a manifest of what each factory changed
+const (
+	pristineDir  = ".pastures-pristine"
+	manifestFile = "factories.json"
+)
+
+// applyFactory restores the upstream copy of target, saving it from the
+// commit checked out on first use, so that fn always transforms pristine
+// files even in a checkout changed by earlier releases. The files fn
+// changed are recorded in the manifest.
+func applyFactory(
+	name string,
+	target string,
+	prefix string,
+	fn func() ([]string, error),
+) error {
+	backup := pristinePath(target)
+
+	_, err := os.Stat(backup)
+
+	switch {
+	case err == nil:
+		if err := utils.CopyPath(backup, target); err != nil {
+			return err
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if err := savePristine(target, backup); err != nil {
+			return err
+		}
+
+		if err := utils.CopyPath(backup, target); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	files, err := fn()
+	if err != nil {
+		return err
+	}
+
+	return recordFactory(target, &FactoryRecord{
+		Name:    name,
+		Target:  target,
+		Prefix:  prefix,
+		Files:   files,
+		Applied: time.Now().UTC(),
+	})
+}
+
+// savePristine saves the upstream copy of target. Targets outside of a git
+// checkout, or not in its commit, are saved as they are.
+func savePristine(target string, backup string) error {
+	err := utils.CopyHead(target, backup)
+	if errors.Is(err, utils.ErrNotCheckout) || errors.Is(err, fs.ErrNotExist) {
+		return utils.CopyPath(target, backup)
+	}
+
+	return err
+}
+
+// revertFactory puts the upstream copy of target back and drops the
+// factory from the manifest. Targets never changed are left alone.
+func revertFactory(name string, target string) error {
+	backup := pristinePath(target)
+
+	if _, err := os.Stat(backup); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err := utils.CopyPath(backup, target); err != nil {
+		return err
+	}
+
+	records, err := readManifest(target)
+	if err != nil {
+		return err
+	}
+
+	records = slices.DeleteFunc(records, func(r *FactoryRecord) bool {
+		return r.Name == name
+	})
+
+	return writeManifest(target, records)
+}
+
+// appliedFactory returns the manifest record of a factory applied to
+// target, or nil when it has not been applied
+func appliedFactory(name string, target string) (*FactoryRecord, error) {
+	records, err := readManifest(target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func recordFactory(target string, record *FactoryRecord) error {
+	records, err := readManifest(target)
+	if err != nil {
+		return err
+	}
+
+	records = slices.DeleteFunc(records, func(r *FactoryRecord) bool {
+		return r.Name == record.Name
+	})
+
+	return writeManifest(target, append(records, record))
+}
+
+func readManifest(target string) ([]*FactoryRecord, error) {
+	records := make([]*FactoryRecord, 0)
+
+	data, err := os.ReadFile(manifestPath(target))
+	if errors.Is(err, fs.ErrNotExist) {
+		return records, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func writeManifest(target string, records []*FactoryRecord) error {
+	data, err := json.MarshalIndent(records, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return utils.CreateFile(manifestPath(target), data, true)
+}
+
+func pristinePath(target string) string {
+	return filepath.Join(
+		filepath.Dir(target),
+		pristineDir,
+		filepath.Base(target),
+	)
+}
+
+func manifestPath(target string) string {
+	return filepath.Join(filepath.Dir(target), pristineDir, manifestFile)
+}
@@ -28,10 +28,21 @@ const (
 )
 
 func NewProviderFile(stage string, prefix string, path string) *ProviderFile {
+	return newStageProviderFile(stage, stage, prefix, path)
+}
+
+// newStageProviderFile places the provider file named after provider in
+// the stage directory, as stages sharing a provider have their own names
+func newStageProviderFile(
+	stage string,
+	provider string,
+	prefix string,
+	path string,
+) *ProviderFile {
 	return &ProviderFile{
-		Name:       stage,
-		LocalPath:  filepath.Join(path, stage, stage+providerSuffix),
-		RemotePath: providerDirName + "/" + stage + providerSuffix,
+		Name:       provider,
+		LocalPath:  filepath.Join(path, stage, provider+providerSuffix),
+		RemotePath: providerDirName + "/" + provider + providerSuffix,
 		Bucket:     bktName(prefix),
 	}
 }
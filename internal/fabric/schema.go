@@ -0,0 +1,353 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// ConfigSchemaVersion is the shape of pasture-fast.tfvars.json written
+	// by this release, matching the variables of the default FAST version
+	ConfigSchemaVersion = 2
+
+	metaSuffix      = ".meta.json"
+	maxPrefixLength = 9
+)
+
+var prefixPattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// migrations upgrade a raw config document by one schema version each,
+// indexed by the version they upgrade from
+var migrations = []migration{
+	{
+		From:        0,
+		Description: "fill defaults in configs written before versioning",
+		Apply:       migrateUnversioned,
+	},
+	{
+		From:        1,
+		Description: "record the default FAST log sinks",
+		Apply:       migrateLogSinks,
+	},
+}
+
+// fastMigrations adapt a raw config document to the variables of a FAST
+// release, in release order. None ship yet, as v32.0.0 is the only release
+// pastures is tested with; add one, with a test case, for each tested
+// release that renames or reshapes bootstrap variables. MigrateFast checks
+// the result against the variables the release declares, so a change
+// missing from here is reported rather than deployed.
+var fastMigrations = []fastMigration{}
+
+// ValidatePrefix checks a prefix can be used in FAST resource names
+func ValidatePrefix(p string) error {
+	if p == "" {
+		return errors.New("is required")
+	}
+
+	if len(p) > maxPrefixLength {
+		return fmt.Errorf("must be at most %d characters", maxPrefixLength)
+	}
+
+	if !prefixPattern.MatchString(p) {
+		return errors.New(
+			"must start with a lowercase letter and contain only " +
+				"lowercase letters and digits",
+		)
+	}
+
+	return nil
+}
+
+// Validate reports every missing or malformed field, keyed by its tfvars
+// path
+func (f *FastConfig) Validate() error {
+	var errs []error
+
+	check := func(ok bool, key string, msg string) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, msg))
+		}
+	}
+
+	if err := ValidatePrefix(f.Prefix); err != nil {
+		errs = append(errs, fmt.Errorf("prefix: %w", err))
+	}
+
+	check(f.Organization != nil, "organization", "is required")
+	if f.Organization != nil {
+		check(f.Organization.Id > 0, "organization.id", "is required")
+		check(f.Organization.Domain != "", "organization.domain", "is required")
+	}
+
+	check(f.BillingAccount != nil, "billing_account", "is required")
+	if f.BillingAccount != nil {
+		check(f.BillingAccount.Id != "", "billing_account.id", "is required")
+	}
+
+	check(f.Groups != nil, "groups", "is required")
+
+	if err := f.LogSinks.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	check(f.Locations != nil, "locations", "is required")
+	if f.Locations != nil {
+		check(f.Locations.Bq != "", "locations.bq", "is required")
+		check(f.Locations.Gcs != "", "locations.gcs", "is required")
+	}
+
+	return errors.Join(errs...)
+}
+
+// decodeConfig upgrades a raw config document to the current schema and
+// decodes it, rejecting mistyped values. Keys pasture does not know, such
+// as FAST variables set by hand, are kept as they are.
+func decodeConfig(data []byte, version int, f *FastConfig) (bool, error) {
+	if version > ConfigSchemaVersion {
+		return false, fmt.Errorf(
+			"config schema version %d is newer than the supported version "+
+				"%d - upgrade pasture to read it",
+			version,
+			ConfigSchemaVersion,
+		)
+	}
+
+	migrated := version < ConfigSchemaVersion
+
+	if migrated {
+		var doc map[string]any
+
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return false, jsonError(data, err)
+		}
+
+		for _, m := range migrations[version:] {
+			logging.Info(
+				"migrating config schema",
+				"from", m.From,
+				"to", m.From+1,
+				"migration", m.Description,
+			)
+
+			if err := m.Apply(doc); err != nil {
+				return false, fmt.Errorf(
+					"migrating config from schema %d: %w", m.From, err,
+				)
+			}
+		}
+
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return false, err
+		}
+	}
+
+	if err := json.Unmarshal(data, f); err != nil {
+		return false, jsonError(data, err)
+	}
+
+	extra, err := unknownKeys(data, f)
+	if err != nil {
+		return false, err
+	}
+
+	for k := range extra {
+		logging.Warn(
+			"config key is not known to pasture and is passed to FAST as is",
+			"key", k,
+		)
+	}
+
+	f.Extra = extra
+
+	if err := f.Validate(); err != nil {
+		return false, err
+	}
+
+	return migrated, nil
+}
+
+// unknownKeys returns the top level keys of a raw config that are not
+// fields of the config
+func unknownKeys(data []byte, f *FastConfig) (map[string]json.RawMessage, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, jsonError(data, err)
+	}
+
+	known, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(known, &fields); err != nil {
+		return nil, err
+	}
+
+	for k := range fields {
+		delete(doc, k)
+	}
+
+	if len(doc) == 0 {
+		return nil, nil
+	}
+
+	return doc, nil
+}
+
+// MigrateFast adapts the config to the variables of a FAST release,
+// applying the migrations of every release since the one it was written for,
+// checks it against the variables the release declares in the bootstrap
+// stage directory, and records the release
+func (f *FastConfig) MigrateFast(to string, bootstrap string) error {
+	from := ""
+	seed := ""
+
+	if f.Meta != nil {
+		from, seed = f.Meta.FastVersion, f.Meta.SeedVersion
+	}
+
+	pending := slices.DeleteFunc(slices.Clone(fastMigrations), func(m fastMigration) bool {
+		return (from != "" && semver.Compare(m.Release, from) <= 0) ||
+			semver.Compare(m.Release, to) > 0
+	})
+
+	if len(pending) > 0 {
+		data, err := f.Marshal()
+		if err != nil {
+			return err
+		}
+
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+
+		for _, m := range pending {
+			logging.Info(
+				"migrating config for FAST",
+				"release", m.Release,
+				"migration", m.Description,
+			)
+
+			if err := m.Apply(doc); err != nil {
+				return fmt.Errorf("migrating config to FAST %s: %w", m.Release, err)
+			}
+		}
+
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+
+		migrated := NewFastConfig()
+		if _, err := decodeConfig(data, ConfigSchemaVersion, migrated); err != nil {
+			return err
+		}
+
+		migrated.Meta = f.Meta
+		*f = *migrated
+	}
+
+	vars, err := StageVariables(bootstrap)
+	if err != nil {
+		return err
+	}
+
+	if err := f.CheckVariables(vars); err != nil {
+		return fmt.Errorf(
+			"pasture has no migration to the variables of FAST %s: %w",
+			to, err,
+		)
+	}
+
+	f.SetVersions(to, seed)
+
+	return nil
+}
+
+// jsonError adds the key or position to JSON decoding errors
+func jsonError(data []byte, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &typeErr):
+		return fmt.Errorf(
+			"%s: expected %s, got %s",
+			typeErr.Field,
+			typeErr.Type,
+			typeErr.Value,
+		)
+	case errors.As(err, &syntaxErr):
+		line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Errorf("line %d: %w", line, err)
+	default:
+		return err
+	}
+}
+
+// metaPath returns the sidecar path holding the schema version of a config
+func metaPath(configFile string) string {
+	return strings.TrimSuffix(configFile, ".tfvars.json") + metaSuffix
+}
+
+func migrateUnversioned(doc map[string]any) error {
+	if doc["fast_features"] == nil {
+		doc["fast_features"] = map[string]any{"sandbox": true}
+	}
+
+	if loc, ok := doc["locations"].(map[string]any); ok {
+		if loc["logging"] == nil || loc["logging"] == "" {
+			loc["logging"] = "global"
+		}
+
+		if loc["pubsub"] == nil {
+			loc["pubsub"] = []any{}
+		}
+	}
+
+	return nil
+}
+
+// migrateLogSinks writes out the sinks FAST applies when none are set, so
+// they can be edited without renaming the deployed ones
+func migrateLogSinks(doc map[string]any) error {
+	if sinks, ok := doc["log_sinks"].(map[string]any); ok && len(sinks) > 0 {
+		return nil
+	}
+
+	sinks := make(map[string]any)
+	for name, s := range DefaultLogSinks() {
+		sinks[name] = map[string]any{"filter": s.Filter, "type": s.Type}
+	}
+
+	doc["log_sinks"] = sinks
+
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// renameVariable is a FAST migration of a renamed bootstrap variable
+func renameVariable(from string, to string) func(map[string]any) error {
+	return func(doc map[string]any) error {
+		if v, ok := doc[from]; ok {
+			doc[to] = v
+			delete(doc, from)
+		}
+
+		return nil
+	}
+}
+
+func TestMigrateFast(t *testing.T) {
+	variables := `variable "prefix" {
+  type = string
+}
+`
+	for _, v := range []string{
+		"organization", "billing_account", "bootstrap_user", "fast_features",
+		"locations", "log_sinks", "groups", "iam", "iam_bindings_additive",
+		"outputs_bucket",
+	} {
+		variables += "\nvariable \"" + v + "\" {\n  default = null\n}\n"
+	}
+
+	// a valid config, to which each case adds its outputs key
+	const base = `"prefix": "abc",
+		"organization": {"id": 1, "domain": "example.com"},
+		"billing_account": {"id": "000000-000000-000000"},
+		"groups": {},
+		"locations": {"bq": "EU", "gcs": "EU"}`
+
+	migrations := []fastMigration{
+		{
+			Release:     "v33.0.0",
+			Description: "rename outputs_location to outputs_bucket",
+			Apply:       renameVariable("outputs_location", "outputs_bucket"),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		config  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "release without migrations",
+			from:   "v33.0.0",
+			to:     "v33.1.0",
+			config: `{` + base + `, "outputs_bucket": "bkt"}`,
+			want:   "bkt",
+		},
+		{
+			name:   "migration of a release in between",
+			from:   "v32.0.0",
+			to:     "v34.0.0",
+			config: `{` + base + `, "outputs_location": "bkt"}`,
+			want:   "bkt",
+		},
+		{
+			name:   "config without a FAST version",
+			to:     "v33.0.0",
+			config: `{` + base + `, "outputs_location": "bkt"}`,
+			want:   "bkt",
+		},
+		{
+			name:    "migration newer than the target",
+			from:    "v32.0.0",
+			to:      "v32.1.0",
+			config:  `{` + base + `, "outputs_location": "bkt"}`,
+			wantErr: ErrVariableMismatch,
+		},
+		{
+			name:    "migration already applied",
+			from:    "v33.0.0",
+			to:      "v34.0.0",
+			config:  `{` + base + `, "outputs_location": "bkt"}`,
+			wantErr: ErrVariableMismatch,
+		},
+	}
+
+	saved := fastMigrations
+	fastMigrations = migrations
+	t.Cleanup(func() { fastMigrations = saved })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bootstrap := t.TempDir()
+
+			err := os.WriteFile(
+				filepath.Join(bootstrap, "variables.tf"),
+				[]byte(variables),
+				0644,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := NewFastConfig()
+			if _, err := decodeConfig([]byte(tt.config), ConfigSchemaVersion, f); err != nil {
+				t.Fatal(err)
+			}
+
+			f.SetVersions(tt.from, "v1.1.4")
+
+			err = f.MigrateFast(tt.to, bootstrap)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("MigrateFast() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("MigrateFast() error = %v", err)
+			}
+
+			var got string
+			if err := json.Unmarshal(f.Extra["outputs_bucket"], &got); err != nil || got != tt.want {
+				t.Errorf("outputs_bucket = %q, %v, want %q", got, err, tt.want)
+			}
+
+			if f.Meta.FastVersion != tt.to || f.Meta.SeedVersion != "v1.1.4" {
+				t.Errorf("MigrateFast() recorded %s and %s", f.Meta.FastVersion, f.Meta.SeedVersion)
+			}
+		})
+	}
+}
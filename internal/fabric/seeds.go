@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	seeds "github.com/GoogleCloudPlatform/pastures-poc-toolkit/terraform"
+)
+
+// seedEmbedManifest records, inside the extracted seeds, the files written
+// from the binary, so the ones a later release drops can be removed
+const seedEmbedManifest = ".pastures-embedded.json"
+
+// UseEmbeddedSeeds links the seeds directory to the seed templates embedded
+// in the binary instead of a clone of the pastures repository
+func (s *Stage) UseEmbeddedSeeds(configPath string) {
+	s.Embedded = filepath.Join(configPath, seedEmbedDst)
+	s.Repository.Link.SetTarget(s.Embedded)
+}
+
+// UseLocalSeeds links the seeds directory to a local working tree, either a
+// checkout of the pastures repository or its terraform directory, so seeds
+// can be tried out without tagging them
+func (s *Stage) UseLocalSeeds(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, seedSrc)); err == nil && info.IsDir() {
+		dir = filepath.Join(dir, seedSrc)
+	} else if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	s.Local = dir
+	s.Repository.Link.SetTarget(dir)
+
+	return nil
+}
+
+// ExtractSeeds writes the embedded seed templates, leaving the files that
+// terraform and pasture generate next to them in place. Templates extracted
+// by an earlier release and no longer embedded are removed.
+func (s *Stage) ExtractSeeds() error {
+	previous, err := s.embeddedFiles()
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0)
+
+	err = fs.WalkDir(seeds.Seeds, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(s.Embedded, p)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := seeds.Seeds.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, p)
+
+		return utils.CreateFile(target, data, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range previous {
+		if slices.Contains(files, p) || !filepath.IsLocal(p) {
+			continue
+		}
+
+		if err := s.removeEmbedded(p); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(files, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return utils.CreateFile(filepath.Join(s.Embedded, seedEmbedManifest), data, true)
+}
+
+// embeddedFiles returns the templates of the last extraction, or none
+// when the seeds were never extracted
+func (s *Stage) embeddedFiles() ([]string, error) {
+	var files []string
+
+	data, err := os.ReadFile(filepath.Join(s.Embedded, seedEmbedManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("%s: %w", seedEmbedManifest, err)
+	}
+
+	return files, nil
+}
+
+// removeEmbedded removes a template that is no longer embedded, and the
+// directories it leaves empty
+func (s *Stage) removeEmbedded(p string) error {
+	target := filepath.Join(s.Embedded, filepath.FromSlash(p))
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for dir := filepath.Dir(target); dir != s.Embedded; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
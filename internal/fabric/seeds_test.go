@@ -0,0 +1,94 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExtractSeeds(t *testing.T) {
+	s := &Stage{Embedded: filepath.Join(t.TempDir(), seedEmbedDst)}
+
+	// an earlier release extracted templates that are no longer embedded,
+	// and terraform generated files next to them
+	writeTestFiles(t, filepath.Join(s.Embedded, "data-cloud"), map[string]string{
+		"main.tf":             "old",
+		"removed.tf":          "old",
+		"terraform.tfvars":    "generated",
+		".terraform.lock.hcl": "generated",
+	})
+	writeTestFiles(t, filepath.Join(s.Embedded, "retired", "data"), map[string]string{
+		"rules.yaml": "old",
+	})
+
+	previous, err := json.Marshal([]string{
+		"data-cloud/main.tf",
+		"data-cloud/removed.tf",
+		"retired/data/rules.yaml",
+		"../outside.tf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFiles(t, s.Embedded, map[string]string{seedEmbedManifest: string(previous)})
+
+	outside := filepath.Join(filepath.Dir(s.Embedded), "outside.tf")
+	writeTestFiles(t, filepath.Dir(s.Embedded), map[string]string{"outside.tf": "kept"})
+
+	for i := 0; i < 2; i++ {
+		if err := s.ExtractSeeds(); err != nil {
+			t.Fatalf("ExtractSeeds() error = %v", err)
+		}
+	}
+
+	for _, p := range []string{"data-cloud/removed.tf", "retired"} {
+		if _, err := os.Stat(filepath.Join(s.Embedded, p)); err == nil {
+			t.Errorf("ExtractSeeds() kept %s", p)
+		}
+	}
+
+	for _, p := range []string{
+		"data-cloud/terraform.tfvars",
+		"data-cloud/.terraform.lock.hcl",
+	} {
+		if _, err := os.Stat(filepath.Join(s.Embedded, p)); err != nil {
+			t.Errorf("ExtractSeeds() removed %s: %v", p, err)
+		}
+	}
+
+	if got, err := os.ReadFile(filepath.Join(s.Embedded, "data-cloud", "main.tf")); err != nil || string(got) == "old" {
+		t.Errorf("ExtractSeeds() left main.tf = %q, %v", got, err)
+	}
+
+	files, err := s.embeddedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(files, "data-cloud/main.tf") || slices.Contains(files, "data-cloud/removed.tf") {
+		t.Errorf("ExtractSeeds() recorded %v", files)
+	}
+
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("ExtractSeeds() removed a file outside of the seeds: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// LogSinkTypes are the sink destinations FAST creates in the log project
+var LogSinkTypes = []string{"bigquery", "logging", "pubsub", "storage"}
+
+// DefaultLogSinks mirror the FAST bootstrap defaults
+func DefaultLogSinks() LogSinks {
+	return LogSinks{
+		"audit-logs": LogSink{
+			Filter: "logName:\"/logs/cloudaudit.googleapis.com%2Factivity\"" +
+				" OR logName:\"/logs/cloudaudit.googleapis.com%2Fsystem_event\"",
+			Type: "logging",
+		},
+		"vpc-sc": LogSink{
+			Filter: "protoPayload.metadata.@type=\"type.googleapis.com/google.cloud.audit.VpcServiceControlAuditMetadata\"",
+			Type:   "logging",
+		},
+	}
+}
+
+// MergeLogSinks overlays sink definitions on the defaults. An override
+// without a filter keeps the default filter, so only the destination
+// type needs to be given to reroute a default sink.
+func MergeLogSinks(defaults LogSinks, overrides LogSinks) LogSinks {
+	merged := maps.Clone(defaults)
+
+	for name, s := range overrides {
+		if d, ok := merged[name]; ok && s.Filter == "" {
+			s.Filter = d.Filter
+		}
+
+		merged[name] = s
+	}
+
+	return merged
+}
+
+// Validate checks every sink has a filter and a known destination type
+func (l LogSinks) Validate() error {
+	var errs []error
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		s := l[name]
+
+		if s.Filter == "" {
+			errs = append(errs, fmt.Errorf("log_sinks.%s.filter: is required", name))
+		}
+
+		if !slices.Contains(LogSinkTypes, s.Type) {
+			errs = append(errs, fmt.Errorf(
+				"log_sinks.%s.type: must be one of %s, got %q",
+				name,
+				strings.Join(LogSinkTypes, ", "),
+				s.Type,
+			))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// prefixSinkName makes sink names unique per pasture, as FAST does not.
+// The prefix is joined as earlier releases did, so deployed sinks keep
+// their names. Sinks come from the defaults and the config file, which
+// never carry the prefix.
+func prefixSinkName(prefix string, name string) string {
+	return prefix + name
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetLogSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		sinks   LogSinks
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			prefix: "abc",
+			sinks:  DefaultLogSinks(),
+			want:   []string{"abcaudit-logs", "abcvpc-sc"},
+		},
+		{
+			name:   "names starting with the prefix are prefixed too",
+			prefix: "audit",
+			sinks:  LogSinks{"audit-logs": {Filter: "f", Type: "logging"}},
+			want:   []string{"auditaudit-logs"},
+		},
+		{
+			name:   "no sinks",
+			prefix: "abc",
+			sinks:  LogSinks{},
+			want:   []string{},
+		},
+		{
+			name:    "invalid sink",
+			prefix:  "abc",
+			sinks:   LogSinks{"audit-logs": {Type: "syslog"}},
+			wantErr: "log_sinks.audit-logs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFastConfig()
+			err := f.SetLogSinks(tt.prefix, tt.sinks)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SetLogSinks() error = %v, want %s", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(f.LogSinks))
+			for name := range f.LogSinks {
+				got = append(got, name)
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SetLogSinks() names = %v, want %v", got, tt.want)
+			}
+
+			for name, s := range tt.sinks {
+				if f.LogSinks[tt.prefix+name] != s {
+					t.Errorf("sink %s = %+v, want %+v", name, f.LogSinks[tt.prefix+name], s)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeLogSinks(t *testing.T) {
+	defaults := DefaultLogSinks()
+
+	merged := MergeLogSinks(defaults, LogSinks{
+		"audit-logs": {Type: "bigquery"},
+		"extra":      {Filter: "severity>=ERROR", Type: "storage"},
+	})
+
+	if got := merged["audit-logs"]; got.Type != "bigquery" || got.Filter != defaults["audit-logs"].Filter {
+		t.Errorf("override without a filter = %+v, want the default filter", got)
+	}
+
+	if got := merged["extra"]; got.Filter != "severity>=ERROR" {
+		t.Errorf("new sink = %+v", got)
+	}
+
+	if merged["vpc-sc"] != defaults["vpc-sc"] || defaults["audit-logs"].Type != "logging" {
+		t.Errorf("MergeLogSinks() changed the defaults")
+	}
+}
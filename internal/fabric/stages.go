@@ -17,6 +17,8 @@ limitations under the License.
 package fabric
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
 
@@ -29,58 +31,80 @@ const ( // TODO: move all to common file for library
 	fastSrc            = "fast/stages"
 	foundationDir      = "foundations"
 	seedDst            = "pastures"
+	seedEmbedDst       = "pastures-embedded"
 	seedSrc            = "terraform"
 	seedDir            = "seeds"
 	fabricRepo         = "https://github.com/GoogleCloudPlatform/cloud-foundation-fabric.git"
 	seedRepo           = "https://github.com/GoogleCloudPlatform/pastures-poc-toolkit"
 	outputBucketSuffix = "-prod-iac-core-outputs-0"
+	seedPrerequisite   = "1-resman" // creates the sandbox seeds deploy into
 )
 
-var (
-	fastStages = []string{"0-bootstrap", "1-resman"}
-	resmanVars = []string{"0-globals", "0-bootstrap"}
-)
+// RepoURL returns the upstream URL of the fast or seed repository
+func RepoURL(name string) (string, error) {
+	switch name {
+	case "fast":
+		return fabricRepo, nil
+	case "seed":
+		return seedRepo, nil
+	}
+
+	return "", fmt.Errorf("unknown repository %q - must be fast or seed", name)
+}
 
+// InitializeFoundationStages returns the required FAST stages and the
+// selected optional ones. Bootstrap reads the pasture vars, and later stages
+// read the tfvars of the stages they depend on from the outputs bucket.
 func InitializeFoundationStages(
 	configPath string,
 	prefix string,
+	selected []string,
 	vars ...*VarsFile,
 ) []*Stage {
 	stages := make([]*Stage, 0)
-	deps := make([]*VarsFile, 0)
+	specs := catalogStages(selected)
 
-	for _, s := range fastStages {
+	for _, spec := range specs {
+		// the first stage reads the pasture vars and publishes them
+		deps := vars
+		uploads := vars
 
-		if s == "1-resman" {
-			for _, r := range resmanVars {
+		if len(spec.Dependencies) > 0 {
+			uploads = nil
+			deps = make([]*VarsFile, 0)
+
+			for _, d := range spec.Dependencies {
 				deps = append(
 					deps,
-					resmanDependencies(r, s, prefix, configPath),
+					stageDependency(d, spec.Name, prefix, configPath),
 				)
 			}
-		} else {
-			deps = vars
 		}
 
 		repo := utils.NewRepo()
 		repo.SetURL(fabricRepo)
 		repo.SetDestination(filepath.Join(configPath, fabricDst))
+		repo.SetCache(utils.CachePath(configPath))
 		repo.SetLink(
 			filepath.Join(configPath, foundationDir),
 			filepath.Join(configPath, fabricDst, fastSrc),
 		)
 
 		stages = append(stages, &Stage{
-			Name:       s,
+			Name:       spec.Name,
 			Type:       "foundation",
-			Path:       filepath.Join(configPath, foundationDir, s),
+			Path:       filepath.Join(configPath, foundationDir, spec.Name),
 			Repository: repo,
-			ProviderFile: NewProviderFile(
-				s,
+			ProviderFile: newStageProviderFile(
+				spec.Name,
+				spec.Provider,
 				prefix,
 				filepath.Join(configPath, foundationDir),
 			),
 			StageVars: deps,
+			Requires:  producers(specs, spec.Dependencies),
+			Produces:  spec.Produces,
+			Uploads:   uploads,
 		})
 	}
 
@@ -91,6 +115,7 @@ func NewSeedStage(configPath string) *Stage {
 	repo := utils.NewRepo()
 	repo.SetURL(seedRepo)
 	repo.SetDestination(filepath.Join(configPath, seedDst))
+	repo.SetCache(utils.CachePath(configPath))
 	repo.SetLink(
 		filepath.Join(configPath, seedDir),
 		filepath.Join(configPath, seedDst, seedSrc),
@@ -99,7 +124,26 @@ func NewSeedStage(configPath string) *Stage {
 	return &Stage{
 		Type:       "seed",
 		Repository: repo,
+		Requires:   []string{seedPrerequisite},
+	}
+}
+
+// InstalledSeeds lists the seed templates linked into the config path
+func InstalledSeeds(configPath string) ([]string, error) {
+	seeds := make([]string, 0)
+
+	entries, err := os.ReadDir(filepath.Join(configPath, seedDir))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			seeds = append(seeds, e.Name())
+		}
 	}
+
+	return seeds, nil
 }
 
 func (s *Stage) HydrateSeed(name string, prefix string, configPath string) {
@@ -112,6 +156,17 @@ func (s *Stage) HydrateSeed(name string, prefix string, configPath string) {
 	)
 }
 
+// UploadOutputs publishes the files the stage provides to later stages
+func (s *Stage) UploadOutputs() error {
+	for _, v := range s.Uploads {
+		if err := v.UploadFile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *Stage) AddVarFile(file *VarsFile) {
 	s.StageVars = append(s.StageVars, file)
 }
@@ -120,6 +175,21 @@ func (s *Stage) SetFactory(factory FabricFactory) {
 	s.Factories = append(s.Factories, factory)
 }
 
+// UpstreamFile returns a file of the stage as it is in the FAST commit
+// checked out, without local changes
+func (s *Stage) UpstreamFile(rel string) ([]byte, error) {
+	return s.Repository.ReadHeadFile(filepath.Join(fastSrc, s.Name, rel))
+}
+
+// Initialized reports whether terraform has been initialized for the stage
+func (s *Stage) Initialized() bool {
+	if _, err := os.Stat(filepath.Join(s.Path, ".terraform")); err != nil {
+		return false
+	}
+
+	return true
+}
+
 func (s *Stage) DiscoverFiles() error {
 	files := make([]ConfigFile, 0)
 
@@ -165,6 +235,13 @@ func (s *Stage) Init(verbose bool) error {
 }
 
 func (s *Stage) Plan(verbose bool) error {
+	_, err := s.Diff(verbose)
+
+	return err
+}
+
+// Diff plans the stage and returns the plan as terraform shows it
+func (s *Stage) Diff(verbose bool) (string, error) {
 	var wg sync.WaitGroup
 	var files []string
 
@@ -202,10 +279,10 @@ func (s *Stage) Plan(verbose bool) error {
 	close(result)
 
 	if planResult.Err != nil {
-		return planResult.Err
+		return "", planResult.Err
 	}
 
-	return nil
+	return planResult.Plan, nil
 }
 
 func (s *Stage) Apply(vars []*terraform.Vars, verbose bool) error {
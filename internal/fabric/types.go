@@ -17,8 +17,12 @@ limitations under the License.
 package fabric
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"gopkg.in/yaml.v3"
 )
 
 type ConfigValues interface {
@@ -37,6 +41,9 @@ type FastConfig struct {
 	Groups         *Groups              `json:"groups"`
 	Iam            IamAuthoritative     `json:"iam"`
 	IamAdditive    IamAdditives         `json:"iam_bindings_additive"`
+	Meta           *ConfigMeta          `json:"-"`
+	// keys pasture does not know, such as FAST variables set by hand
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type BillingAccount struct {
@@ -46,7 +53,12 @@ type BillingAccount struct {
 }
 
 type FastFeatures struct {
-	Sandbox bool `json:"sandbox"`
+	DataPlatform   bool `json:"data_platform"`
+	Gcve           bool `json:"gcve"`
+	Gke            bool `json:"gke"`
+	ProjectFactory bool `json:"project_factory"`
+	Sandbox        bool `json:"sandbox"`
+	Teams          bool `json:"teams"`
 }
 
 type Locations struct {
@@ -76,7 +88,10 @@ type IamAdditives map[string]IamAdditive
 
 type LogSinks map[string]LogSink
 
-type LogSink map[string]string
+type LogSink struct {
+	Filter string `json:"filter" mapstructure:"filter"`
+	Type   string `json:"type" mapstructure:"type"`
+}
 
 type Stage struct {
 	Name         string
@@ -86,10 +101,60 @@ type Stage struct {
 	ProviderFile *ProviderFile
 	StageVars    []*VarsFile
 	Factories    []FabricFactory
+	Requires     []string
+	Produces     []string
+	Uploads      []*VarsFile
+	Embedded     string
+	Local        string
+}
+
+// StageSpec describes a FAST stage: the tfvars of earlier stages it reads
+// from the outputs bucket, the tfvars it writes there and the name of its
+// provider file
+type StageSpec struct {
+	Name         string
+	Provider     string
+	Dependencies []string
+	Produces     []string
+	Required     bool
+}
+
+// Graph orders stages by their prerequisites
+type Graph struct {
+	stages []*Stage
+	index  map[string]*Stage
 }
 
 type FabricFactory interface {
 	ApplyFactory(prefix string) error
+	RevertFactory() error
+	Applied() (*FactoryRecord, error)
+	Target() string
+}
+
+// OverlayFactory writes the overlay files of a profile over the files of
+// a stage
+type OverlayFactory struct {
+	Name      string
+	Path      string
+	StagePath string
+	StatePath string
+}
+
+// OverlayFile is the manifest entry of a stage file written by an overlay
+type OverlayFile struct {
+	Path    string `json:"path"`
+	Created bool   `json:"created,omitempty"`
+	Sum     string `json:"sum"`
+}
+
+// FactoryRecord is the manifest entry of a factory applied to a stage
+type FactoryRecord struct {
+	Name    string    `json:"name"`
+	Target  string    `json:"target"`
+	Prefix  string    `json:"prefix,omitempty"`
+	Files   []string  `json:"files"`
+	Applied time.Time `json:"applied"`
 }
 
 type RoleFactory struct {
@@ -97,6 +162,22 @@ type RoleFactory struct {
 	Path string
 }
 
+// OrgPolicyFactory writes the org policies of an overlay over the FAST
+// org policy factory
+type OrgPolicyFactory struct {
+	Name    string
+	Path    string
+	Overlay *yaml.Node
+}
+
+// FirewallFactory writes the rules of an overlay over the FAST
+// hierarchical firewall policy factory
+type FirewallFactory struct {
+	Name    string
+	Path    string
+	Overlay *yaml.Node
+}
+
 type ConfigFile interface {
 	UploadFile() error
 	DownloadFile() error
@@ -108,6 +189,10 @@ type VarsFile struct {
 	RemotePath string
 	Bucket     string
 	Config     ConfigValues
+	Generation int64
+	// generation of the metadata sidecar, uploaded under the same kind of
+	// precondition as the config
+	MetaGeneration int64
 }
 
 type ProviderFile struct {
@@ -116,3 +201,64 @@ type ProviderFile struct {
 	RemotePath string
 	Bucket     string
 }
+
+type ConfigChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// ConfigMeta is stored next to the config file as it cannot hold keys
+// that are not FAST variables
+type ConfigMeta struct {
+	SchemaVersion int      `json:"schema_version"`
+	FastVersion   string   `json:"fast_version,omitempty"`
+	SeedVersion   string   `json:"seed_version,omitempty"`
+	SeedPath      string   `json:"seed_path,omitempty"`
+	Residency     string   `json:"residency,omitempty"`
+	Region        string   `json:"region,omitempty"`
+	Stages        []string `json:"stages,omitempty"`
+}
+
+// Bundle is the manifest of an air-gapped bundle
+type Bundle struct {
+	PastureVersion   string            `json:"pasture_version"`
+	TerraformVersion string            `json:"terraform_version"`
+	Os               string            `json:"os"`
+	Arch             string            `json:"arch"`
+	Platforms        []string          `json:"platforms"`
+	Fast             *utils.CacheEntry `json:"fast"`
+	Seed             *utils.CacheEntry `json:"seed"`
+	Created          time.Time         `json:"created"`
+}
+
+// BundleOptions selects the checkouts and provider platforms of a bundle
+type BundleOptions struct {
+	PastureVersion string
+	FastUrl        string
+	FastVersion    string
+	SeedUrl        string
+	SeedVersion    string
+	Platforms      []string
+	Verbose        bool
+}
+
+type migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+// fastMigration adapts the config to the variables of a FAST release
+type fastMigration struct {
+	Release     string
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+type Residency struct {
+	Name           string
+	Locations      Locations
+	Region         string
+	RegionPrefixes []string
+}
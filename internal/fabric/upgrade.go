@@ -0,0 +1,277 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// An upgrade clones the new FAST release next to the current checkout and
+// points the foundations link at it, so going back is a relink. The
+// checkout it replaces is kept until the next upgrade.
+const (
+	upgradeDst  = "fast-"
+	previousDst = "fast.previous"
+)
+
+// NewUpgradeRepo returns the repository of a FAST release, cloned next to
+// the current checkout
+func NewUpgradeRepo(configPath string, url string, tag string) *utils.Repo {
+	dst := filepath.Join(configPath, upgradeDst+tag)
+
+	repo := utils.NewRepo()
+	repo.SetURL(url)
+	repo.SetRef("refs/tags/" + tag)
+	repo.SetDestination(dst)
+	repo.SetCache(utils.CachePath(configPath))
+	repo.SetLink(
+		filepath.Join(configPath, foundationDir),
+		filepath.Join(dst, fastSrc),
+	)
+
+	return repo
+}
+
+// CheckoutStagePath returns the directory of a stage in a FAST checkout,
+// whichever checkout the foundations link points at
+func CheckoutStagePath(checkout string, stage string) string {
+	return filepath.Join(checkout, fastSrc, stage)
+}
+
+// UpgradeFactories returns the factories applied to a stage in the current
+// checkout at current, set up for the stage path the foundations link
+// points at. Overlays are carried over as the keys they changed from the
+// pristine copy, as the flags they came from are not kept.
+func UpgradeFactories(
+	configPath string,
+	stage *Stage,
+	current string,
+) ([]FabricFactory, error) {
+	factories := make([]FabricFactory, 0)
+
+	if stage.Type != "foundation" {
+		return factories, nil
+	}
+
+	roles := NewRoleFactory(current)
+	if r, err := roles.Applied(); err != nil {
+		return nil, err
+	} else if r != nil {
+		factories = append(factories, NewRoleFactory(stage.Path))
+	}
+
+	policies := &OrgPolicyFactory{
+		Name: "org-policies",
+		Path: filepath.Join(current, orgPolicyDir),
+	}
+	if r, err := policies.Applied(); err != nil {
+		return nil, err
+	} else if r != nil {
+		overlay, err := changedKeys(policies.Path, pristinePath(policies.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		factories = append(factories, &OrgPolicyFactory{
+			Name:    policies.Name,
+			Path:    filepath.Join(stage.Path, orgPolicyDir),
+			Overlay: overlay,
+		})
+	}
+
+	rules := &FirewallFactory{
+		Name: "hierarchical-firewall",
+		Path: filepath.Join(current, firewallRuleFile),
+	}
+	if r, err := rules.Applied(); err != nil {
+		return nil, err
+	} else if r != nil {
+		overlay, err := changedKeys(rules.Path, pristinePath(rules.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		factories = append(factories, &FirewallFactory{
+			Name:    rules.Name,
+			Path:    filepath.Join(stage.Path, firewallRuleFile),
+			Overlay: overlay,
+		})
+	}
+
+	profiles, err := OverlayProfiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range profiles {
+		f := NewOverlayFactory(configPath, p, stage)
+
+		if r, err := f.Applied(); err != nil {
+			return nil, err
+		} else if r != nil {
+			factories = append(factories, f)
+		}
+	}
+
+	return factories, nil
+}
+
+// changedKeys returns the top level keys of a YAML mapping, or of the
+// mappings of a factory directory, that are new or differ from its
+// pristine copy
+func changedKeys(p string, pristine string) (*yaml.Node, error) {
+	doc, err := readYamlMappings(p)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := readYamlMappings(pristine)
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[string][]byte)
+
+	m := base.Content[0].Content
+	for i := 0; i < len(m); i += 2 {
+		b, err := yaml.Marshal(m[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		before[m[i].Value] = b
+	}
+
+	changed := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	m = doc.Content[0].Content
+	for i := 0; i < len(m); i += 2 {
+		b, err := yaml.Marshal(m[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		if old, ok := before[m[i].Value]; ok && bytes.Equal(old, b) {
+			continue
+		}
+
+		changed.Content = append(changed.Content, m[i], m[i+1])
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{changed}}, nil
+}
+
+// readYamlMappings reads a YAML mapping, or merges the mappings of every
+// file of a directory, later keys replacing earlier ones
+func readYamlMappings(p string) (*yaml.Node, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return readYamlMapping(p)
+	}
+
+	files, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	index := make(map[string]int)
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		doc, err := readYamlMapping(filepath.Join(p, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := doc.Content[0].Content
+		for i := 0; i < len(m); i += 2 {
+			if j, ok := index[m[i].Value]; ok {
+				merged.Content[j+1] = m[i+1]
+				continue
+			}
+
+			index[m[i].Value] = len(merged.Content)
+			merged.Content = append(merged.Content, m[i], m[i+1])
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{merged}}, nil
+}
+
+// SnapshotOverlays copies the applied overlay state, which describes the
+// current checkout, and returns a function that puts it back
+func SnapshotOverlays(configPath string) (func() error, error) {
+	state := filepath.Join(configPath, overlayDir, overlayStateDir)
+
+	if _, err := os.Stat(state); os.IsNotExist(err) {
+		return func() error { return utils.RemoveDir(state) }, nil
+	}
+
+	snapshot, err := os.MkdirTemp("", "pasture-overlays")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.CopyPath(state, filepath.Join(snapshot, overlayStateDir)); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		defer os.RemoveAll(snapshot)
+
+		return utils.CopyPath(filepath.Join(snapshot, overlayStateDir), state)
+	}, nil
+}
+
+// FinishUpgrade makes the upgrade checkout the current one, keeping the
+// checkout it replaces as the previous one
+func FinishUpgrade(configPath string, next *utils.Repo) error {
+	current := filepath.Join(configPath, fabricDst)
+	previous := filepath.Join(configPath, previousDst)
+
+	if err := utils.RemoveDir(previous); err != nil {
+		return err
+	}
+
+	if err := os.Rename(current, previous); err != nil {
+		return err
+	}
+
+	if err := os.Rename(next.Dst, current); err != nil {
+		return err
+	}
+
+	link := utils.Symlink{
+		Source: filepath.Join(configPath, foundationDir),
+		Target: filepath.Join(current, fastSrc),
+	}
+
+	return link.Link()
+}
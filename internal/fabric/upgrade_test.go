@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  map[string]string
+		pristine map[string]string
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			current:  map[string]string{"rules.yaml": "a: 1\nb: 2\n"},
+			pristine: map[string]string{"rules.yaml": "a: 1\nb: 2\n"},
+			want:     []string{},
+		},
+		{
+			name:     "changed and new keys",
+			current:  map[string]string{"rules.yaml": "a: 1\nb: 3\nc: 4\n"},
+			pristine: map[string]string{"rules.yaml": "a: 1\nb: 2\n"},
+			want:     []string{"b", "c"},
+		},
+		{
+			name: "keys moved to another file of the directory",
+			current: map[string]string{
+				"compute.yaml":  "a: 1\n",
+				"iam.yaml":      "",
+				"pastures.yaml": "b: 2\nc: 5\n",
+			},
+			pristine: map[string]string{
+				"compute.yaml": "a: 1\n",
+				"iam.yaml":     "b: 2\nc: 3\n",
+			},
+			want: []string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			current := filepath.Join(dir, "org-policies")
+			pristine := filepath.Join(dir, "pristine", "org-policies")
+
+			writeTestFiles(t, current, tt.current)
+			writeTestFiles(t, pristine, tt.pristine)
+
+			p, base := current, pristine
+			if len(tt.current) == 1 {
+				p = filepath.Join(current, "rules.yaml")
+				base = filepath.Join(pristine, "rules.yaml")
+			}
+
+			changed, err := changedKeys(p, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := mappingKeys(changed)
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changedKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
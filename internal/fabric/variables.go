@@ -0,0 +1,175 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrVariableMismatch is returned when a config does not fit the variables
+// a FAST stage declares
+var ErrVariableMismatch = errors.New("config does not match the FAST variables")
+
+var (
+	variableBlock   = regexp.MustCompile(`(?m)^variable\s+"([^"]+)"\s*\{`)
+	defaultArgument = regexp.MustCompile(`^[ \t]*default[ \t]*=`)
+)
+
+// StageVariables reads the input variables a stage declares in its
+// variables*.tf files, mapped to whether they are required
+func StageVariables(dir string) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "variables*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no variables declared in %s", dir)
+	}
+
+	vars := make(map[string]bool)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range variableBlock.FindAllSubmatchIndex(data, -1) {
+			name := string(data[m[2]:m[3]])
+			body := blockBody(data[m[1]:])
+
+			vars[name] = !hasDefault(body)
+		}
+	}
+
+	return vars, nil
+}
+
+// blockBody returns the content of a block up to its closing brace,
+// skipping braces inside quoted strings
+func blockBody(data []byte) string {
+	depth := 1
+	quoted := false
+
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth--; depth == 0 {
+				return string(data[:i])
+			}
+		}
+	}
+
+	return string(data)
+}
+
+// hasDefault reports whether a variable block sets a default at its top
+// level rather than inside a type expression or a nested block
+func hasDefault(body string) bool {
+	depth := 0
+	quoted := false
+
+	for i := 0; i < len(body); i++ {
+		lineStart := i == 0 || body[i-1] == '\n'
+
+		if lineStart && !quoted && depth == 0 &&
+			defaultArgument.MatchString(body[i:]) {
+			return true
+		}
+
+		switch c := body[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case strings.IndexByte("{[(", c) >= 0:
+			depth++
+		case strings.IndexByte("}])", c) >= 0:
+			depth--
+		}
+	}
+
+	return false
+}
+
+// CheckVariables compares the config with the variables of a FAST stage,
+// reporting keys the stage does not declare and required variables the
+// config does not set
+func (f *FastConfig) CheckVariables(vars map[string]bool) error {
+	data, err := f.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	var undeclared, missing []string
+
+	for k, v := range doc {
+		if _, ok := vars[k]; !ok && v != nil {
+			undeclared = append(undeclared, k)
+		}
+	}
+
+	for k, required := range vars {
+		if required && doc[k] == nil {
+			missing = append(missing, k)
+		}
+	}
+
+	slices.Sort(undeclared)
+	slices.Sort(missing)
+
+	var errs []error
+
+	if len(undeclared) > 0 {
+		errs = append(errs, fmt.Errorf(
+			"%s not declared: %w",
+			strings.Join(undeclared, ", "),
+			ErrVariableMismatch,
+		))
+	}
+
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf(
+			"%s required but not set: %w",
+			strings.Join(missing, ", "),
+			ErrVariableMismatch,
+		))
+	}
+
+	return errors.Join(errs...)
+}
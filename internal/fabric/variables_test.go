@@ -0,0 +1,125 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageVariables(t *testing.T) {
+	tests := []struct {
+		name string
+		tf   string
+		want map[string]bool
+	}{
+		{
+			name: "required and optional",
+			tf: `variable "prefix" {
+  description = "Prefix used for resources (no default)."
+  type        = string
+}
+
+variable "groups" {
+  type    = map(string)
+  default = {}
+}
+`,
+			want: map[string]bool{"prefix": true, "groups": false},
+		},
+		{
+			name: "defaults nested in types and validations",
+			tf: `variable "locations" {
+  type = object({
+    bq = optional(string, "EU")
+    default = optional(string)
+  })
+  validation {
+    condition     = var.locations != null
+    error_message = "Braces { in strings are ignored."
+  }
+}
+
+variable "log_sinks" {
+  type = map(object({
+    filter = string
+  }))
+  default = {
+    audit-logs = { filter = "a" }
+  }
+  nullable = false
+}
+`,
+			want: map[string]bool{"locations": true, "log_sinks": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(tt.tf), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := StageVariables(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("StageVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	f := NewFastConfig()
+	f.Prefix = "ex1"
+
+	vars := map[string]bool{
+		"prefix":                true,
+		"outputs_bucket":        true,
+		"organization":          false,
+		"billing_account":       false,
+		"bootstrap_user":        false,
+		"fast_features":         false,
+		"locations":             false,
+		"log_sinks":             false,
+		"groups":                false,
+		"iam":                   false,
+		"iam_bindings_additive": false,
+	}
+
+	err := f.CheckVariables(vars)
+	if !errors.Is(err, ErrVariableMismatch) {
+		t.Fatalf("CheckVariables() = %v, want a missing outputs_bucket", err)
+	}
+
+	delete(vars, "outputs_bucket")
+	if err := f.CheckVariables(vars); err != nil {
+		t.Errorf("CheckVariables() = %v, want nil", err)
+	}
+
+	delete(vars, "prefix")
+	if err := f.CheckVariables(vars); !errors.Is(err, ErrVariableMismatch) {
+		t.Errorf("CheckVariables() = %v, want an undeclared prefix", err)
+	}
+}
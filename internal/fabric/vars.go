@@ -17,8 +17,11 @@ limitations under the License.
 package fabric
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 
+	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
 )
 
@@ -51,28 +54,50 @@ func (v *VarsFile) AddConfig(config ConfigValues) {
 	v.Config = config
 }
 
+// UploadFile uploads the vars file, requiring the remote object to be
+// unchanged since it was downloaded when a generation is known
 func (v *VarsFile) UploadFile() error {
-	if err := google.UploadObject(
+	gen, err := google.UploadObjectIfGeneration(
 		v.Bucket,
 		v.RemotePath,
 		v.LocalPath,
-	); err != nil {
+		v.Generation,
+	)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	v.Generation = gen
+
+	return v.uploadMeta()
 }
 
 func (v *VarsFile) DownloadFile() error {
-	if err := google.DownloadObject(
+	gen, err := google.DownloadObjectGeneration(
 		v.Bucket,
 		v.LocalPath,
 		v.RemotePath,
-	); err != nil {
+	)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	v.Generation = gen
+
+	return v.downloadMeta()
+}
+
+// DownloadCopy downloads the file and its metadata sidecar into dir,
+// leaving the local copy as it is, and returns the path of the copy
+func (v *VarsFile) DownloadCopy(dir string) (string, error) {
+	remote := *v
+	remote.LocalPath = filepath.Join(dir, v.Name)
+
+	if err := remote.DownloadFile(); err != nil {
+		return "", err
+	}
+
+	return remote.LocalPath, nil
 }
 
 func (v *VarsFile) GetFileMetadata() error {
@@ -83,7 +108,67 @@ func (v *VarsFile) GetFileMetadata() error {
 	return nil
 }
 
-func resmanDependencies(
+// uploadMeta uploads the schema sidecar of the pasture config, if any,
+// requiring it to be unchanged since it was downloaded like the config
+func (v *VarsFile) uploadMeta() error {
+	if v.Name != varFileName {
+		return nil
+	}
+
+	local := metaPath(v.LocalPath)
+	if _, err := os.Stat(local); err != nil {
+		return nil
+	}
+
+	gen, err := google.UploadObjectIfGeneration(
+		v.Bucket,
+		metaPath(v.RemotePath),
+		local,
+		v.MetaGeneration,
+	)
+	if err != nil {
+		return err
+	}
+
+	v.MetaGeneration = gen
+
+	return nil
+}
+
+// downloadMeta fetches the schema sidecar of the pasture config. A config
+// uploaded before versioning has none, so a stale local copy is removed.
+func (v *VarsFile) downloadMeta() error {
+	if v.Name != varFileName {
+		return nil
+	}
+
+	local := metaPath(v.LocalPath)
+
+	gen, err := google.DownloadObjectGeneration(
+		v.Bucket,
+		local,
+		metaPath(v.RemotePath),
+	)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		v.MetaGeneration = 0
+
+		if err := os.Remove(local); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	v.MetaGeneration = gen
+
+	return nil
+}
+
+// stageDependency is the tfvars file of an earlier stage, downloaded into
+// the directory of the stage that reads it
+func stageDependency(
 	name string,
 	stage string,
 	prefix string,
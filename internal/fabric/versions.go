@@ -0,0 +1,144 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrCommitMismatch is returned when a FAST tag no longer points at the
+// commit pastures was tested with
+var ErrCommitMismatch = errors.New("FAST tag does not match the pinned commit")
+
+// ErrCommitUnpinned is returned when a tested FAST release has no pinned
+// commit to verify a checkout against
+var ErrCommitUnpinned = errors.New("FAST release has no pinned commit")
+
+// ErrIncompatible is returned when a seed release does not work with the
+// FAST release of the foundation
+var ErrIncompatible = errors.New("seed is not compatible with the FAST foundation")
+
+// ErrUnknownCompatibility is returned when a seed release is not in the
+// compatibility matrix
+var ErrUnknownCompatibility = errors.New("seed compatibility is unknown")
+
+// FastVersions are the FAST releases pastures is tested with and the commit
+// each tag pointed at when it was. Checkouts of a tested release are refused
+// until its commit is pinned.
+var FastVersions = map[string]string{
+	"v32.0.0": "", // TODO: pin the commit of the v32.0.0 tag
+}
+
+// TestedFastVersions returns the sorted FAST releases pastures is tested with
+func TestedFastVersions() []string {
+	versions := make([]string, 0, len(FastVersions))
+
+	for v := range FastVersions {
+		versions = append(versions, v)
+	}
+
+	sort.Strings(versions)
+
+	return versions
+}
+
+// TestedFastVersion reports whether pastures is tested with a FAST tag
+func TestedFastVersion(tag string) bool {
+	_, ok := FastVersions[tag]
+
+	return ok
+}
+
+// VerifyFastCommit checks the commit of a FAST checkout against the commit
+// pinned for its tag. Releases pastures is not tested with are not checked.
+func VerifyFastCommit(tag string, commit string) error {
+	pinned, ok := FastVersions[tag]
+
+	switch {
+	case !ok:
+		return nil
+	case pinned == "":
+		return fmt.Errorf("%s: %w", tag, ErrCommitUnpinned)
+	case pinned != commit:
+		return fmt.Errorf(
+			"%s is at %s instead of %s: %w",
+			tag, commit, pinned, ErrCommitMismatch,
+		)
+	}
+
+	return nil
+}
+
+// SeedCompatibility maps each seed release to the FAST releases it works
+// with, oldest first. Seeds pin their own Fabric modules, e.g. data-cloud
+// uses v29.0.0 modules, so this is about the foundation they deploy into.
+// Add the seeds of every pastures release.
+var SeedCompatibility = map[string][]string{
+	"v1.1.4": {"v32.0.0"},
+}
+
+// CheckCompatibility reports whether the seeds of a release work with a FAST
+// foundation release
+func CheckCompatibility(fast string, seed string) error {
+	versions, ok := SeedCompatibility[seed]
+	if !ok {
+		return fmt.Errorf(
+			"seed %s is not in the compatibility matrix: %w",
+			seed, ErrUnknownCompatibility,
+		)
+	}
+
+	if slices.Contains(versions, fast) {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"seed %s works with FAST %s, not %s: %w",
+		seed, strings.Join(versions, ", "), fast, ErrIncompatible,
+	)
+}
+
+// SuggestFastVersion returns the newest FAST release the seeds of a release
+// work with
+func SuggestFastVersion(seed string) string {
+	versions := SeedCompatibility[seed]
+	if len(versions) == 0 {
+		return ""
+	}
+
+	return versions[len(versions)-1]
+}
+
+// SeedVersionsFor returns the sorted seed releases that work with a FAST
+// release
+func SeedVersionsFor(fast string) []string {
+	seeds := make([]string, 0)
+
+	for seed, versions := range SeedCompatibility {
+		if slices.Contains(versions, fast) {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	sort.Strings(seeds)
+
+	return seeds
+}
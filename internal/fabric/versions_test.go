@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabric
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyFastCommit(t *testing.T) {
+	const pinned = "0123456789abcdef0123456789abcdef01234567"
+
+	saved := FastVersions
+	FastVersions = map[string]string{
+		"v32.0.0": pinned,
+		"v33.0.0": "",
+	}
+	t.Cleanup(func() { FastVersions = saved })
+
+	tests := []struct {
+		name    string
+		tag     string
+		commit  string
+		wantErr error
+	}{
+		{
+			name:   "pinned commit",
+			tag:    "v32.0.0",
+			commit: pinned,
+		},
+		{
+			name:    "moved tag",
+			tag:     "v32.0.0",
+			commit:  "fedcba9876543210fedcba9876543210fedcba98",
+			wantErr: ErrCommitMismatch,
+		},
+		{
+			name:    "tested release without a pin",
+			tag:     "v33.0.0",
+			commit:  pinned,
+			wantErr: ErrCommitUnpinned,
+		},
+		{
+			name:   "untested release",
+			tag:    "v34.0.0",
+			commit: pinned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyFastCommit(tt.tag, tt.commit)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyFastCommit() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -19,12 +19,11 @@ package google
 import (
 	"context"
 	"errors"
-
-	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/lestrrat-go/jwx/jwk"
@@ -131,24 +130,24 @@ func AppDefaultCredentials() (string, error) {
 	email, err := findToken(filePath)
 
 	if err != nil {
-		fmt.Println("\nNo default credentials found - authorizing with Google")
+		output.Info("\nNo default credentials found - authorizing with Google")
 		authCmd := exec.Command(
 			"gcloud", "auth", "application-default", "login",
 			"--no-launch-browser",
 		)
-		authCmd.Stdout = os.Stdout
+		authCmd.Stdout = output.Writer()
 		authCmd.Stderr = os.Stderr
 		authCmd.Stdin = os.Stdin
 
 		if err := authCmd.Run(); err != nil {
-			fmt.Printf("Error starting gcloud command: %v\n", err)
+			output.Error("Error starting gcloud command:", err)
 			return "", err
 		}
 
 		// need to refresh adc context to get email now that we're auth'd
 		email, _ = findToken(filePath)
 	} else {
-		fmt.Println("\nFound default Google credentials - skipping")
+		output.Info("\nFound default Google credentials - skipping")
 	}
 
 	return email, nil
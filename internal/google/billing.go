@@ -0,0 +1,61 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/api/cloudbilling/v1"
+)
+
+const (
+	billingAccountPrefix = "billingAccounts/"
+)
+
+// ListBillingAccounts returns the billing accounts visible to the caller
+func ListBillingAccounts() ([]BillingAccount, error) {
+	ctx := context.Background()
+
+	accounts := make([]BillingAccount, 0)
+
+	svc, err := cloudbilling.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.BillingAccounts.List().Pages(
+		ctx,
+		func(page *cloudbilling.ListBillingAccountsResponse) error {
+			for _, a := range page.BillingAccounts {
+				accounts = append(accounts, BillingAccount{
+					Id:          strings.TrimPrefix(a.Name, billingAccountPrefix),
+					DisplayName: a.DisplayName,
+					Open:        a.Open,
+				})
+			}
+
+			return nil
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
@@ -18,20 +18,42 @@ package google
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
+// ErrObjectChanged is returned when an upload precondition fails because
+// the object was replaced since it was read
+var ErrObjectChanged = errors.New("object was modified by another writer")
+
 func DownloadObject(bucketName string, savePath string, object string) error {
+	_, err := DownloadObjectGeneration(bucketName, savePath, object)
+	return err
+}
+
+// DownloadObjectGeneration downloads an object and returns the generation
+// that was read, for use as an upload precondition
+func DownloadObjectGeneration(
+	bucketName string,
+	savePath string,
+	object string,
+) (int64, error) {
 	ctx := context.Background()
 
+	logging.Debug("downloading object", "bucket", bucketName, "object", object)
+
 	client, err := storage.NewClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create storage client: %w", err)
+		return 0, fmt.Errorf("failed to create storage client: %w", err)
 	}
 
 	bkt := client.Bucket(bucketName)
@@ -39,7 +61,7 @@ func DownloadObject(bucketName string, savePath string, object string) error {
 
 	r, err := obj.NewReader(ctx)
 	if err != nil {
-		return fmt.Errorf(
+		return 0, fmt.Errorf(
 			"failed to create reader for object %s: %w",
 			object,
 			err,
@@ -54,7 +76,7 @@ func DownloadObject(bucketName string, savePath string, object string) error {
 
 	if _, err := os.Stat(savePath); err == nil {
 		if err := os.Remove(savePath); err != nil {
-			return fmt.Errorf(
+			return 0, fmt.Errorf(
 				"failed to remove existing file %s: %w",
 				savePath,
 				err,
@@ -64,12 +86,12 @@ func DownloadObject(bucketName string, savePath string, object string) error {
 
 	createdFile, err := os.Create(savePath)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", savePath, err)
+		return 0, fmt.Errorf("failed to create file %s: %w", savePath, err)
 	}
 	defer createdFile.Close()
 
 	if _, err := io.Copy(createdFile, r); err != nil {
-		return fmt.Errorf(
+		return 0, fmt.Errorf(
 			"failed to copy object %s to file %s: %w",
 			object,
 			savePath,
@@ -77,7 +99,7 @@ func DownloadObject(bucketName string, savePath string, object string) error {
 		)
 	}
 
-	return nil
+	return r.Attrs.Generation, nil
 }
 
 func UploadObject(
@@ -85,18 +107,33 @@ func UploadObject(
 	objectPath string,
 	localPath string,
 ) error {
+	_, err := UploadObjectIfGeneration(bucketName, objectPath, localPath, 0)
+	return err
+}
+
+// UploadObjectIfGeneration uploads a file only if the object is still at
+// the given generation, returning the new generation. A generation of zero
+// uploads unconditionally.
+func UploadObjectIfGeneration(
+	bucketName string,
+	objectPath string,
+	localPath string,
+	generation int64,
+) (int64, error) {
 	ctx := context.Background()
 
+	logging.Debug("uploading object", "bucket", bucketName, "object", objectPath)
+
 	client, err := storage.NewClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create storage client: %w", err)
+		return 0, fmt.Errorf("failed to create storage client: %w", err)
 	}
 	defer client.Close()
 
 	// Open local file
 	f, err := os.Open(localPath)
 	if err != nil {
-		return fmt.Errorf("os.Open: %w", err)
+		return 0, fmt.Errorf("os.Open: %w", err)
 	}
 	defer f.Close()
 
@@ -104,16 +141,29 @@ func UploadObject(
 	defer cancel()
 
 	o := client.Bucket(bucketName).Object(objectPath)
+	if generation != 0 {
+		o = o.If(storage.Conditions{GenerationMatch: generation})
+	}
 
 	wc := o.NewWriter(ctx)
 	if _, err = io.Copy(wc, f); err != nil {
-		return fmt.Errorf("io.Copy: %w", err)
+		return 0, fmt.Errorf("io.Copy: %w", err)
 	}
 	if err := wc.Close(); err != nil {
-		return fmt.Errorf("Writer.Close: %w", err)
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+			return 0, fmt.Errorf(
+				"%w: gs://%s/%s",
+				ErrObjectChanged,
+				bucketName,
+				objectPath,
+			)
+		}
+
+		return 0, fmt.Errorf("Writer.Close: %w", err)
 	}
 
-	return nil
+	return wc.Attrs().Generation, nil
 }
 
 func GetObjectAttributes(
@@ -134,3 +184,75 @@ func GetObjectAttributes(
 
 	return objAttrs, nil
 }
+
+func WriteObject(bucketName string, objectPath string, data []byte) error {
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %w", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	defer cancel()
+
+	wc := client.Bucket(bucketName).Object(objectPath).NewWriter(ctx)
+	if _, err := wc.Write(data); err != nil {
+		return fmt.Errorf("Writer.Write: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %w", err)
+	}
+
+	return nil
+}
+
+func ReadObject(bucketName string, objectPath string) ([]byte, error) {
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(bucketName).Object(objectPath).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to create reader for object %s: %w",
+			objectPath,
+			err,
+		)
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func ListObjects(bucketName string, prefix string) ([]string, error) {
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	defer client.Close()
+
+	objects := make([]string, 0)
+
+	it := client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, attrs.Name)
+	}
+
+	return objects, nil
+}
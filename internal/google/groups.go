@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+const (
+	customerPrefix  = "customers/"
+	discussionLabel = "cloudidentity.googleapis.com/groups.discussion_forum"
+)
+
+// ListGroups returns the Cloud Identity groups of a directory customer
+func ListGroups(customerId string) ([]Group, error) {
+	ctx := context.Background()
+
+	groups := make([]Group, 0)
+
+	svc, err := cloudidentity.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.Groups.List().
+		Parent(customerPrefix+customerId).
+		View("BASIC").
+		Pages(ctx, func(page *cloudidentity.ListGroupsResponse) error {
+			for _, g := range page.Groups {
+				if g.GroupKey == nil {
+					continue
+				}
+
+				groups = append(groups, Group{
+					Email:       g.GroupKey.Id,
+					DisplayName: g.DisplayName,
+				})
+			}
+
+			return nil
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// CreateGroup creates a Cloud Identity group owned by the caller
+func CreateGroup(customerId string, email string, name string) (*Group, error) {
+	ctx := context.Background()
+
+	svc, err := cloudidentity.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Debug("creating group", "email", email, "customer", customerId)
+
+	op, err := svc.Groups.Create(&cloudidentity.Group{
+		GroupKey:    &cloudidentity.EntityKey{Id: email},
+		Parent:      customerPrefix + customerId,
+		DisplayName: name,
+		Labels:      map[string]string{discussionLabel: ""},
+	}).InitialGroupConfig("WITH_INITIAL_OWNER").Do()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Error != nil {
+		return nil, errors.New(op.Error.Message)
+	}
+
+	return &Group{Email: email, DisplayName: name}, nil
+}
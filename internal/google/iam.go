@@ -19,12 +19,36 @@ package google
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 
 	"cloud.google.com/go/iam/apiv1/iampb"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
 )
 
+// OrgIAMDelta returns the role grants the group is missing on the
+// organization, without changing the policy
+func OrgIAMDelta(org *Organization, g string, r []string) ([]IamChange, error) {
+	ctx := context.Background()
+	c, err := resourcemanager.NewOrganizationsClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.Close()
+
+	policy, err := c.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: orgResource(org),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return iamDelta(policy, groupMember(org, g), r), nil
+}
+
 // TODO: update to include any kind of principal
 func SetRequiredOrgIAMRoles(org *Organization, g string, r []string) error {
 	ctx := context.Background()
@@ -36,29 +60,30 @@ func SetRequiredOrgIAMRoles(org *Organization, g string, r []string) error {
 
 	defer c.Close()
 
-	group := g + "@" + org.Domain
+	member := groupMember(org, g)
+
+	logging.Debug("granting organization roles", "member", member, "roles", r)
 
 	// Retrieve the current IAM policy
-	getPolicyReq := &iampb.GetIamPolicyRequest{
-		Resource: fmt.Sprintf("organizations/%s", strconv.Itoa(org.Id)),
-	}
-	currentPolicy, err := c.GetIamPolicy(ctx, getPolicyReq)
+	currentPolicy, err := c.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: orgResource(org),
+	})
 	if err != nil {
 		return err
 	}
 
-	// Merge the new roles with the existing ones
-	// TODO: rather than merge, is there a 'member' operation
-	// that is gracefully additive?
-	for _, role := range r {
+	delta := iamDelta(currentPolicy, member, r)
+	if len(delta) == 0 {
+		logging.Debug("organization roles already granted", "member", member)
+		return nil
+	}
+
+	// Merge the missing roles with the existing bindings
+	for _, d := range delta {
 		found := false
 		for _, binding := range currentPolicy.Bindings {
-			if binding.Role == role {
-				// If the role already exists, append the new member
-				binding.Members = append(
-					binding.Members,
-					fmt.Sprintf("group:%s", group),
-				)
+			if binding.Role == d.Role {
+				binding.Members = append(binding.Members, d.Member)
 				found = true
 				break
 			}
@@ -68,8 +93,8 @@ func SetRequiredOrgIAMRoles(org *Organization, g string, r []string) error {
 			currentPolicy.Bindings = append(
 				currentPolicy.Bindings,
 				&iampb.Binding{
-					Role:    role,
-					Members: []string{fmt.Sprintf("group:%s", group)},
+					Role:    d.Role,
+					Members: []string{d.Member},
 				},
 			)
 		}
@@ -77,7 +102,7 @@ func SetRequiredOrgIAMRoles(org *Organization, g string, r []string) error {
 
 	// Set the updated IAM policy
 	setPolicyReq := &iampb.SetIamPolicyRequest{
-		Resource: fmt.Sprintf("organizations/%s", strconv.Itoa(org.Id)),
+		Resource: orgResource(org),
 		Policy:   currentPolicy,
 	}
 	_, err = c.SetIamPolicy(ctx, setPolicyReq)
@@ -87,3 +112,32 @@ func SetRequiredOrgIAMRoles(org *Organization, g string, r []string) error {
 
 	return nil
 }
+
+// iamDelta lists the roles in r that the policy does not grant to member
+func iamDelta(policy *iampb.Policy, member string, r []string) []IamChange {
+	delta := make([]IamChange, 0)
+
+	for _, role := range r {
+		granted := false
+		for _, binding := range policy.Bindings {
+			if binding.Role == role && slices.Contains(binding.Members, member) {
+				granted = true
+				break
+			}
+		}
+
+		if !granted {
+			delta = append(delta, IamChange{Role: role, Member: member})
+		}
+	}
+
+	return delta
+}
+
+func groupMember(org *Organization, g string) string {
+	return fmt.Sprintf("group:%s@%s", g, org.Domain)
+}
+
+func orgResource(org *Organization) string {
+	return "organizations/" + strconv.Itoa(org.Id)
+}
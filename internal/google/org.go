@@ -25,12 +25,56 @@ import (
 
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
 	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 	"google.golang.org/api/iterator"
 )
 
+// ListOrganizations returns every organization visible to the caller
+func ListOrganizations() ([]Organization, error) {
+	ctx := context.Background()
+
+	orgList := []Organization{}
+
+	c, err := resourcemanager.NewOrganizationsClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.Close()
+
+	it := c.SearchOrganizations(
+		ctx,
+		&resourcemanagerpb.SearchOrganizationsRequest{},
+	)
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		orgId, err := strconv.Atoi(strings.TrimPrefix(resp.Name, "organizations/"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		orgList = append(orgList, Organization{
+			Domain:     resp.GetDisplayName(),
+			Id:         orgId,
+			CustomerId: resp.GetDirectoryCustomerId(),
+		})
+	}
+
+	return orgList, nil
+}
+
 // TODO: move this to a method for an org struct
 func GetOrganization(domain string) (*Organization, error) {
-	fmt.Println("\nGetting organization details...")
+	output.Info("\nGetting organization details...")
 	ctx := context.Background()
 
 	orgList := []Organization{}
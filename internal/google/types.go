@@ -22,3 +22,19 @@ type Organization struct {
 	Id         int    `json:"id"`
 	CustomerId string `json:"customer_id"`
 }
+
+type BillingAccount struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	Open        bool   `json:"open"`
+}
+
+type Group struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+type IamChange struct {
+	Role   string `json:"role"`
+	Member string `json:"member"`
+}
@@ -0,0 +1,268 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/google"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/terraform"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
+)
+
+const (
+	historyFileName = "history.jsonl"
+	historyDirName  = "history"
+	ResultSuccess   = "success"
+	ResultFailure   = "failure"
+)
+
+var (
+	current *Record
+	mu      sync.Mutex
+)
+
+// Start opens a new run record for the command being executed. The record
+// is persisted when Finish is called with the outcome of the command.
+func Start(command string, flags map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = &Record{
+		Timestamp: time.Now().UTC(),
+		Command:   command,
+		Flags:     flags,
+		Stages:    []string{},
+	}
+}
+
+func SetUser(email string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil {
+		current.User = email
+	}
+}
+
+func SetBucket(bucket string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil {
+		current.bucket = bucket
+	}
+}
+
+func SetFastRef(ref string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil {
+		current.FastRef = ref
+	}
+}
+
+func AddStage(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil {
+		current.Stages = append(current.Stages, name)
+	}
+}
+
+// Finish closes the current run record with the outcome of the command,
+// appends it to the local history file and copies it to the outputs
+// bucket when one is known. History is best effort and never fails a run.
+func Finish(runErr error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return
+	}
+
+	r := current
+	current = nil
+
+	r.Duration = time.Since(r.Timestamp).Seconds()
+	r.Result = ResultSuccess
+	r.LogDir = logging.Dir()
+
+	if runErr != nil {
+		r.Result = ResultFailure
+		r.Error = runErr.Error()
+	}
+
+	path, err := utils.ConfigPath()
+	if err != nil {
+		return
+	}
+
+	if v, err := terraform.TfVersion(path); err == nil {
+		r.TerraformVersion = v
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	if err := utils.AppendFile(
+		filepath.Join(path, historyFileName),
+		append(data, '\n'),
+	); err != nil {
+		output.Warn("Unable to write run history:", err)
+	}
+
+	if r.bucket == "" {
+		return
+	}
+
+	// the outputs bucket does not exist until the bootstrap stage is applied
+	if err := google.WriteObject(
+		r.bucket,
+		remoteName(r),
+		data,
+	); err != nil && !errors.Is(err, storage.ErrBucketNotExist) {
+		output.Warn("Unable to upload run history to bucket:", r.bucket)
+	}
+}
+
+// Read loads the run records stored in the local history file.
+func Read(filter *Filter) ([]Record, error) {
+	path, err := utils.ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.ReadFile(filepath.Join(path, historyFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var r Record
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("corrupt history record: %w", err)
+		}
+
+		records = append(records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter.apply(records), nil
+}
+
+// ReadRemote loads the run records stored under the history prefix of
+// the outputs bucket, which includes runs from other machines.
+func ReadRemote(bucket string, filter *Filter) ([]Record, error) {
+	objects, err := google.ListObjects(bucket, historyDirName+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0)
+
+	for _, o := range objects {
+		var r Record
+
+		data, err := google.ReadObject(bucket, o)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("corrupt history record %s: %w", o, err)
+		}
+
+		records = append(records, r)
+	}
+
+	return filter.apply(records), nil
+}
+
+func (f *Filter) apply(records []Record) []Record {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+
+	if f == nil {
+		return records
+	}
+
+	filtered := make([]Record, 0)
+
+	for _, r := range records {
+		if f.Command != "" && !strings.Contains(r.Command, f.Command) {
+			continue
+		}
+
+		if f.Result != "" && r.Result != f.Result {
+			continue
+		}
+
+		if f.User != "" && r.User != f.User {
+			continue
+		}
+
+		if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+			continue
+		}
+
+		filtered = append(filtered, r)
+	}
+
+	// keep the most recent records
+	if f.Limit > 0 && len(filtered) > f.Limit {
+		filtered = filtered[len(filtered)-f.Limit:]
+	}
+
+	return filtered
+}
+
+func remoteName(r *Record) string {
+	return historyDirName + "/" +
+		r.Timestamp.Format("20060102T150405.000Z") + "-" +
+		strings.ReplaceAll(r.Command, " ", "-") + ".json"
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import "time"
+
+type Record struct {
+	Timestamp        time.Time         `json:"timestamp"`
+	User             string            `json:"user"`
+	Command          string            `json:"command"`
+	Flags            map[string]string `json:"flags"`
+	Stages           []string          `json:"stages"`
+	Duration         float64           `json:"duration_seconds"`
+	Result           string            `json:"result"`
+	Error            string            `json:"error,omitempty"`
+	TerraformVersion string            `json:"terraform_version"`
+	FastRef          string            `json:"fast_ref"`
+	LogDir           string            `json:"log_dir,omitempty"`
+
+	bucket string
+}
+
+type Filter struct {
+	Command string
+	Result  string
+	User    string
+	Since   time.Time
+	Limit   int
+}
@@ -0,0 +1,304 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logDirName     = "logs"
+	mainLogName    = "pasture.log"
+	stageLogSuffix = ".log"
+	traceLogSuffix = "-trace.log"
+	keepRuns       = 25
+)
+
+var (
+	level      = new(slog.LevelVar)
+	current    *run
+	logger     = newLogger(nil)
+	fileLogger *slog.Logger
+	mu         sync.Mutex
+
+	levels = map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+)
+
+func init() {
+	level.Set(slog.LevelWarn)
+}
+
+// SetLevel controls which records are written to the console. The per-run
+// log file always receives every level.
+func SetLevel(l string) error {
+	v, ok := levels[strings.ToLower(l)]
+	if !ok {
+		return fmt.Errorf(
+			"unsupported log level %q - must be one of debug, info, warn, error",
+			l,
+		)
+	}
+
+	level.Set(v)
+
+	return nil
+}
+
+// Start creates a log directory for the current run under the config path
+// and begins writing every log record to it
+func Start(configPath string, command string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	name := time.Now().UTC().Format("20060102T150405Z") + "-" +
+		strings.ReplaceAll(command, " ", "-")
+	dir := filepath.Join(configPath, logDirName, name)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, mainLogName))
+	if err != nil {
+		return err
+	}
+
+	current = &run{
+		dir:    dir,
+		main:   f,
+		stages: make(map[string]*os.File),
+	}
+	logger = newLogger(f)
+	fileLogger = slog.New(
+		slog.NewTextHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+
+	prune(filepath.Join(configPath, logDirName))
+
+	return nil
+}
+
+// Dir returns the log directory of the current run, if any
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return ""
+	}
+
+	return current.dir
+}
+
+// StageWriter returns a writer that appends to the log file of a stage.
+// Output is discarded when no run has been started.
+func StageWriter(stage string) io.Writer {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return io.Discard
+	}
+
+	if f, ok := current.stages[stage]; ok {
+		return f
+	}
+
+	f, err := os.OpenFile(
+		filepath.Join(current.dir, stage+stageLogSuffix),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0644,
+	)
+	if err != nil {
+		logger.Warn("unable to open stage log", "stage", stage, "error", err)
+		return io.Discard
+	}
+
+	current.stages[stage] = f
+
+	return f
+}
+
+// TracePath returns the file Terraform should write TF_LOG output to for a
+// stage when the user has not set TF_LOG_PATH
+func TracePath(stage string) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return ""
+	}
+
+	return filepath.Join(current.dir, stage+traceLogSuffix)
+}
+
+// Close flushes and closes the files of the current run
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return
+	}
+
+	for _, f := range current.stages {
+		f.Close()
+	}
+
+	current.main.Close()
+	current = nil
+	logger = newLogger(nil)
+	fileLogger = nil
+}
+
+// Event records console output in the run log without echoing it back to
+// the console
+func Event(l string, msg string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fileLogger == nil {
+		return
+	}
+
+	v, ok := levels[l]
+	if !ok {
+		v = slog.LevelInfo
+	}
+
+	fileLogger.Log(context.Background(), v, msg, args...)
+}
+
+func Debug(msg string, args ...any) {
+	get().Debug(msg, args...)
+}
+
+func Info(msg string, args ...any) {
+	get().Info(msg, args...)
+}
+
+func Warn(msg string, args ...any) {
+	get().Warn(msg, args...)
+}
+
+func Error(msg string, args ...any) {
+	get().Error(msg, args...)
+}
+
+func get() *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return logger
+}
+
+func newLogger(file io.Writer) *slog.Logger {
+	handlers := []slog.Handler{
+		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}),
+	}
+
+	if file != nil {
+		handlers = append(
+			handlers,
+			slog.NewTextHandler(file, &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+			}),
+		)
+	}
+
+	return slog.New(&fanoutHandler{handlers: handlers})
+}
+
+// prune removes the oldest run directories beyond the retention limit
+func prune(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	runs := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() {
+			runs = append(runs, e.Name())
+		}
+	}
+
+	// names start with a sortable timestamp
+	sort.Strings(runs)
+
+	for len(runs) > keepRuns {
+		os.RemoveAll(filepath.Join(dir, runs[0]))
+		runs = runs[1:]
+	}
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, l) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+
+	return &fanoutHandler{handlers: handlers}
+}
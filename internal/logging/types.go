@@ -0,0 +1,34 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"log/slog"
+	"os"
+)
+
+// fanoutHandler sends each record to every handler that accepts its level
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+// run holds the open files of a per-run log directory
+type run struct {
+	dir    string
+	main   *os.File
+	stages map[string]*os.File
+}
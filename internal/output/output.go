@@ -0,0 +1,286 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+
+	statusSuccess = "success"
+	statusFailure = "failure"
+)
+
+// Failure categories and their stable exit codes
+const (
+	General   Category = "general"
+	Usage     Category = "usage"
+	Auth      Category = "auth"
+	Preflight Category = "preflight"
+	Terraform Category = "terraform"
+	Storage   Category = "storage"
+)
+
+var (
+	exitCodes = map[Category]int{
+		General:   1,
+		Usage:     2,
+		Auth:      3,
+		Preflight: 4,
+		Terraform: 5,
+		Storage:   6,
+	}
+
+	format  = FormatText
+	command string
+	started = time.Now()
+	data    = make(map[string]any)
+	onExit  []func(error)
+	onEvent []func(*Event)
+	mu      sync.Mutex
+)
+
+func SetFormat(f string) error {
+	switch f {
+	case FormatText, FormatJSON, FormatYAML:
+		format = f
+	default:
+		return fmt.Errorf(
+			"unsupported output format %q - must be one of text, json, yaml", f,
+		)
+	}
+
+	return nil
+}
+
+// Structured reports whether output is machine readable
+func Structured() bool {
+	return format != FormatText
+}
+
+// Writer returns the stream that subprocess and free text output should
+// use. Structured modes keep stdout reserved for events and results.
+func Writer() io.Writer {
+	if Structured() {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// Begin marks the start of a command for the final result object
+func Begin(cmd string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	command = cmd
+	started = time.Now()
+}
+
+// OnExit registers a function that is called with the outcome of the
+// command before the process reports its result
+func OnExit(fn func(error)) {
+	onExit = append(onExit, fn)
+}
+
+// OnEvent registers a function that receives every progress event,
+// regardless of the output format
+func OnEvent(fn func(*Event)) {
+	onEvent = append(onEvent, fn)
+}
+
+func Info(a ...any) {
+	emit(levelInfo, "", sprintln(a...))
+}
+
+func Infof(f string, a ...any) {
+	emit(levelInfo, "", fmt.Sprintf(f, a...))
+}
+
+func Warn(a ...any) {
+	emit(levelWarn, "", sprintln(a...))
+}
+
+func Error(a ...any) {
+	emit(levelError, "", sprintln(a...))
+}
+
+// Stage emits a progress event attributed to a stage
+func Stage(name string, a ...any) {
+	emit(levelInfo, name, sprintln(a...))
+}
+
+func Stagef(name string, f string, a ...any) {
+	emit(levelInfo, name, fmt.Sprintf(f, a...))
+}
+
+// Set attaches a value to the data of the final result object
+func Set(key string, value any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data[key] = value
+}
+
+// Done reports a successful command
+func Done() {
+	finish(nil, "")
+}
+
+// ExitCode returns the process exit code of a failure category
+func ExitCode(c Category) int {
+	return exitCodes[c]
+}
+
+// CheckErr reports a failed command and exits with the code of the
+// failure category. It does nothing when err is nil.
+func CheckErr(c Category, err error) {
+	if err == nil {
+		return
+	}
+
+	finish(err, c)
+	os.Exit(exitCodes[c])
+}
+
+// Fail wraps an error with its failure category
+func Fail(c Category, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Failure{Category: c, Err: err}
+}
+
+// CategoryOf returns the category of the first Failure wrapped in err, or
+// General when there is none
+func CategoryOf(err error) Category {
+	var f *Failure
+	if errors.As(err, &f) {
+		return f.Category
+	}
+
+	return General
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+func finish(err error, c Category) {
+	if err != nil && format == FormatText {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+
+	for _, fn := range onExit {
+		fn(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	r := &Result{
+		Kind:     "result",
+		Command:  command,
+		Status:   statusSuccess,
+		Duration: time.Since(started).Seconds(),
+	}
+
+	if len(data) > 0 {
+		r.Data = data
+	}
+
+	if err != nil {
+		r.Status = statusFailure
+		r.Category = c
+		r.ExitCode = exitCodes[c]
+		r.Error = err.Error()
+	}
+
+	if Structured() {
+		write(r)
+	}
+}
+
+func emit(level string, stage string, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	e := &Event{
+		Kind:    "event",
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Stage:   stage,
+		Message: strings.TrimSpace(msg),
+	}
+
+	for _, fn := range onEvent {
+		fn(e)
+	}
+
+	if format == FormatText {
+		fmt.Println(msg)
+		return
+	}
+
+	write(e)
+}
+
+// write encodes a value as a JSON line or a YAML document on stdout
+func write(v any) {
+	switch format {
+	case FormatJSON:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintln(os.Stdout, string(b))
+	case FormatYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprint(os.Stdout, "---\n"+string(b))
+	}
+}
+
+func sprintln(a ...any) string {
+	return strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+}
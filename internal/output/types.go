@@ -0,0 +1,48 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package output
+
+import "time"
+
+// Category groups failures so wrappers can react to them by exit code
+type Category string
+
+// Failure carries the category of an error returned from code that cannot
+// exit on its own, such as stages running concurrently
+type Failure struct {
+	Category Category
+	Err      error
+}
+
+type Event struct {
+	Kind    string    `json:"kind" yaml:"kind"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Level   string    `json:"level" yaml:"level"`
+	Stage   string    `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Message string    `json:"message" yaml:"message"`
+}
+
+type Result struct {
+	Kind     string         `json:"kind" yaml:"kind"`
+	Command  string         `json:"command" yaml:"command"`
+	Status   string         `json:"status" yaml:"status"`
+	Category Category       `json:"category,omitempty" yaml:"category,omitempty"`
+	ExitCode int            `json:"exit_code" yaml:"exit_code"`
+	Error    string         `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration float64        `json:"duration_seconds" yaml:"duration_seconds"`
+	Data     map[string]any `json:"data,omitempty" yaml:"data,omitempty"`
+}
@@ -14,18 +14,23 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package terraform // TODO: figure out how to set stdout and stderr in tfexec and log lines
+package terraform
 
 import (
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/utils"
 	"github.com/hashicorp/terraform-exec/tfexec"
 )
 
@@ -35,16 +40,19 @@ func TfInit(dir string, m bool, verbose bool) error {
 
 	ctx := context.Background()
 
-	tf, _ := initializeTerraformClient(dir, verbose)
+	tf, err := initializeTerraformClient(dir, verbose)
+	if err != nil {
+		return err
+	}
+
+	captureOutput(tf, dir, "init", verbose)
 
 	// If true, we need to migrate the state to a remote location
 	if m {
 		tfInitOptions = append(tfInitOptions, tfexec.ForceCopy(m))
 	}
 
-	err := tf.Init(ctx, tfInitOptions...)
-
-	return err
+	return tf.Init(ctx, tfInitOptions...)
 }
 
 func TfPlan(
@@ -72,6 +80,8 @@ func TfPlan(
 		return result
 	}
 
+	captureOutput(tf, dir, "plan", verbose)
+
 	// Create the plan file coordinates
 	tmpDir, err := os.MkdirTemp(dir, "pastures")
 	if err != nil {
@@ -132,7 +142,12 @@ func TfApply(
 	// find the binary and setup the client
 	ctx := context.Background()
 
-	tf, _ := initializeTerraformClient(dir, verbose)
+	tf, err := initializeTerraformClient(dir, verbose)
+	if err != nil {
+		return err
+	}
+
+	captureOutput(tf, dir, "apply", verbose)
 
 	// include a var files if they're provided
 	for _, v := range varFiles {
@@ -151,7 +166,7 @@ func TfApply(
 	}
 
 	// do what we came here to do
-	err := tf.Apply(ctx, tfApplyOptions...) // TODO: tf validate before
+	err = tf.Apply(ctx, tfApplyOptions...) // TODO: tf validate before
 
 	if err != nil {
 		return err
@@ -174,7 +189,12 @@ func TfDestroy(
 	// find the binary and setup the client
 	ctx := context.Background()
 
-	tf, _ := initializeTerraformClient(dir, verbose)
+	tf, err := initializeTerraformClient(dir, verbose)
+	if err != nil {
+		return err
+	}
+
+	captureOutput(tf, dir, "destroy", verbose)
 
 	// include a var files if they're provided
 	for _, v := range varFiles {
@@ -193,7 +213,7 @@ func TfDestroy(
 	}
 
 	// do what we came here to do
-	err := tf.Destroy(ctx, tfDestroyOptions...) // TODO: tf validate before
+	err = tf.Destroy(ctx, tfDestroyOptions...) // TODO: tf validate before
 
 	if err != nil {
 		return err
@@ -260,6 +280,76 @@ func TfPull(dir string, verbose bool) (string, error) {
 	return s, nil
 }
 
+func TfVersion(dir string) (string, error) {
+	ctx := context.Background()
+
+	tf, err := initializeTerraformClient(dir, false)
+
+	if err != nil {
+		return "", err
+	}
+
+	v, _, err := tf.Version(ctx, true)
+
+	if err != nil {
+		return "", err
+	}
+
+	return v.String(), nil
+}
+
+// TfGetModules downloads the modules of the configuration in dir
+func TfGetModules(dir string, verbose bool) error {
+	ctx := context.Background()
+
+	tf, err := initializeTerraformClient(dir, verbose)
+	if err != nil {
+		return err
+	}
+
+	captureOutput(tf, dir, "get", verbose)
+
+	return tf.Get(ctx)
+}
+
+// TfProvidersMirror copies the providers the configuration in dir requires
+// for each platform, e.g. linux_amd64, into a filesystem mirror at target.
+// tfexec has no mirror command, so the binary is run directly.
+func TfProvidersMirror(dir string, target string, platforms []string) error {
+	p, err := findBinary()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"providers", "mirror"}
+	for _, platform := range platforms {
+		args = append(args, "-platform="+platform)
+	}
+
+	stage := filepath.Base(dir)
+	w := logging.StageWriter(stage)
+
+	logging.Debug("running terraform", "command", "providers mirror", "stage", stage, "dir", dir)
+
+	c := exec.Command(p, append(args, target)...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+	c.Stdout = w
+	c.Stderr = w
+
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("terraform providers mirror in %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// CliConfigPath returns the terraform CLI configuration written by a
+// bundle import under the config path
+func CliConfigPath(configPath string) string {
+	return filepath.Join(configPath, cliConfigFile)
+}
+
 func NewVars() *Vars {
 	return &Vars{}
 }
@@ -279,12 +369,109 @@ func buildClient(d string, p string, v bool) (*tfexec.Terraform, error) {
 	}
 
 	if v {
-		tf.SetStdout(os.Stdout) // Write tf logs to stdout
+		tf.SetStdout(output.Writer()) // Write tf logs to the console
+	}
+
+	// an imported bundle replaces the registry, unless the caller already
+	// points terraform at a CLI configuration of their own
+	if err := useBundle(); err != nil {
+		return nil, err
 	}
 
 	return tf, nil
 }
 
+// useBundle sets TF_CLI_CONFIG_FILE for terraform, which tfexec passes on
+// from the environment, when a bundle was imported and it is not set already
+func useBundle() error {
+	if os.Getenv(cliConfigEnvVar) != "" {
+		return nil
+	}
+
+	configPath, err := utils.ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	rc := CliConfigPath(configPath)
+	if _, err := os.Stat(rc); err != nil {
+		return nil
+	}
+
+	logging.Debug("using bundle terraform configuration", "path", rc)
+
+	return os.Setenv(cliConfigEnvVar, rc)
+}
+
+// captureOutput streams terraform stdout and stderr to the stage log of the
+// current run, and stdout to the console as well when verbose. Commands that
+// print state or outputs are deliberately not captured.
+func captureOutput(tf *tfexec.Terraform, dir string, op string, v bool) {
+	stage := filepath.Base(dir)
+	w := logging.StageWriter(stage)
+
+	logging.Debug("running terraform", "command", op, "stage", stage, "dir", dir)
+
+	// must run before stdout is redirected as it calls terraform version
+	passthroughLog(tf, stage)
+
+	fmt.Fprintf(
+		w,
+		"\n==> terraform %s (%s)\n",
+		op,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+
+	if v {
+		tf.SetStdout(io.MultiWriter(output.Writer(), w))
+	} else {
+		tf.SetStdout(w)
+	}
+
+	tf.SetStderr(w)
+}
+
+// passthroughLog forwards TF_LOG settings from the environment, which
+// tfexec otherwise strips, writing the trace to the run log directory
+// unless TF_LOG_PATH is set
+func passthroughLog(tf *tfexec.Terraform, stage string) {
+	level := os.Getenv("TF_LOG")
+	if level == "" {
+		return
+	}
+
+	path := os.Getenv("TF_LOG_PATH")
+	if path == "" {
+		path = logging.TracePath(stage)
+	}
+
+	if path == "" {
+		logging.Warn("TF_LOG is set but there is no log path", "stage", stage)
+		return
+	}
+
+	if err := tf.SetLog(level); err != nil {
+		logging.Warn("unable to pass TF_LOG to terraform", "error", err)
+		return
+	}
+
+	if core := os.Getenv("TF_LOG_CORE"); core != "" {
+		if err := tf.SetLogCore(core); err != nil {
+			logging.Warn("unable to pass TF_LOG_CORE to terraform", "error", err)
+		}
+	}
+
+	if provider := os.Getenv("TF_LOG_PROVIDER"); provider != "" {
+		if err := tf.SetLogProvider(provider); err != nil {
+			logging.Warn("unable to pass TF_LOG_PROVIDER to terraform", "error", err)
+		}
+	}
+
+	if err := tf.SetLogPath(path); err != nil {
+		logging.Warn("unable to pass TF_LOG_PATH to terraform", "error", err)
+	}
+}
+
 func findBinary() (string, error) {
 	execPath, err := exec.LookPath("terraform")
 
@@ -16,6 +16,11 @@ limitations under the License.
 
 package terraform
 
+const (
+	cliConfigFile   = "bundle/terraform.rc"
+	cliConfigEnvVar = "TF_CLI_CONFIG_FILE"
+)
+
 type PlanResult struct {
 	Plan string
 	Err  error
@@ -0,0 +1,463 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The clone cache keeps one checkout per repository URL and tag, shared by
+// every profile. Only tags are cached, as branches move.
+const (
+	cacheDir    = "cache/git"
+	cacheSuffix = ".json"
+)
+
+// CachePath returns the clone cache directory under the config path
+func CachePath(configPath string) string {
+	return filepath.Join(configPath, cacheDir)
+}
+
+// Cacheable reports whether checkouts of a ref can be shared
+func Cacheable(ref string) bool {
+	return strings.HasPrefix(ref, "refs/tags/")
+}
+
+// CacheKey names the cache entry of a repository URL and ref
+func CacheKey(url string, ref string) string {
+	sum := sha256.Sum256([]byte(url + "@" + ref))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// ListCache returns the entries of the clone cache
+func ListCache(cache string) ([]*CacheEntry, error) {
+	entries := make([]*CacheEntry, 0)
+
+	files, err := os.ReadDir(cache)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != cacheSuffix {
+			continue
+		}
+
+		e, err := ReadCacheEntry(cache, strings.TrimSuffix(f.Name(), cacheSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// ReadCacheEntry reads the description of the cache entry with key
+func ReadCacheEntry(cache string, key string) (*CacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(cache, key+cacheSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &CacheEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("cache entry %s: %w", key, err)
+	}
+
+	return e, nil
+}
+
+// ImportArchive unpacks a .tar.gz of a repository checkout into the cache
+// as the content of url at ref. An archive holding a single top level
+// directory, like a release tarball, is unpacked from inside it.
+func ImportArchive(cache string, archive string, url string, ref string) (*CacheEntry, error) {
+	key := CacheKey(url, ref)
+	dst := filepath.Join(cache, key)
+	tmp := dst + ".tmp"
+
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+
+	if err := ExtractArchive(archive, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	// unwrap a single top level directory
+	root := tmp
+	if entries, err := os.ReadDir(tmp); err == nil && len(entries) == 1 &&
+		entries[0].IsDir() && entries[0].Name() != ".git" {
+		root = filepath.Join(tmp, entries[0].Name())
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(root, dst); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+
+	commit, err := ArchiveCommit(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeCacheEntry(cache, key, url, ref, archive, commit)
+}
+
+// ClearCache removes every entry of the clone cache
+func ClearCache(cache string) error {
+	return RemoveDir(cache)
+}
+
+// CreateArchive packs the content of src into a .tar.gz archive
+func CreateArchive(src string, archive string) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		h, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		h.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			h.Name += "/"
+		}
+
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer in.Close()
+
+		_, err = io.Copy(tw, in)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// ExtractArchive unpacks a .tar.gz archive into dst
+func ExtractArchive(archive string, dst string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	defer gz.Close()
+
+	root, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// refuse entries that would land outside of dst, including through
+		// the symlinks extracted before them
+		name := filepath.Clean(filepath.FromSlash(h.Name))
+
+		parent, ok := resolveWithin(root, root, filepath.Dir(name), 0)
+		if !ok || !within(root, filepath.Join(root, name)) {
+			return fmt.Errorf("archive entry %s is outside of the archive", h.Name)
+		}
+
+		target := filepath.Join(parent, filepath.Base(name))
+
+		if h.Typeflag == tar.TypeSymlink {
+			if filepath.IsAbs(h.Linkname) {
+				return fmt.Errorf(
+					"archive symlink %s points at the absolute path %s",
+					h.Name, h.Linkname,
+				)
+			}
+
+			if _, ok := resolveWithin(root, parent, h.Linkname, 0); !ok {
+				return fmt.Errorf(
+					"archive symlink %s points outside of the archive: %s",
+					h.Name, h.Linkname,
+				)
+			}
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			out, err := os.OpenFile(
+				target,
+				os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+				fs.FileMode(h.Mode).Perm(),
+			)
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+
+			if err := out.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(h.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// maxLinkDepth bounds the symlinks followed when resolving a path
+const maxLinkDepth = 40
+
+// resolveWithin resolves a relative path from dir, following the symlinks
+// already on disk, and reports whether every step stays inside root
+func resolveWithin(root string, dir string, path string, depth int) (string, bool) {
+	if depth > maxLinkDepth {
+		return "", false
+	}
+
+	cur := dir
+
+	for _, c := range strings.Split(filepath.ToSlash(path), "/") {
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			next := filepath.Join(cur, c)
+
+			if link, err := os.Readlink(next); err == nil {
+				if filepath.IsAbs(link) {
+					return "", false
+				}
+
+				resolved, ok := resolveWithin(root, cur, link, depth+1)
+				if !ok {
+					return "", false
+				}
+
+				next = resolved
+			}
+
+			cur = next
+		}
+
+		if !within(root, cur) {
+			return "", false
+		}
+	}
+
+	return cur, true
+}
+
+// within reports whether path is root or inside it
+func within(root string, path string) bool {
+	return path == root ||
+		strings.HasPrefix(path, root+string(os.PathSeparator))
+}
+
+// cloneCached fills the destination from the cache entry of the repo,
+// cloning into the cache first when there is none
+func (r *Repo) cloneCached() error {
+	src, err := r.Cached()
+	if err != nil {
+		return err
+	}
+
+	if err := CopyPath(src, r.Dst); err != nil {
+		return err
+	}
+
+	e, err := ReadCacheEntry(r.Cache, CacheKey(r.Url, r.Ref))
+	if err != nil {
+		return err
+	}
+
+	return r.writeCheckout(e.Commit, src)
+}
+
+// Cached returns the path of the cache entry of the repo, cloning into the
+// cache first when there is none
+func (r *Repo) Cached() (string, error) {
+	key := CacheKey(r.Url, r.Ref)
+	src := filepath.Join(r.Cache, key)
+
+	if _, err := os.Stat(src); err == nil {
+		return src, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	tmp := src + ".tmp"
+
+	if err := RemoveDir(tmp); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(r.Cache, 0755); err != nil {
+		return "", err
+	}
+
+	if err := r.fetch(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	commit, err := headCommit(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	if err := os.Rename(tmp, src); err != nil {
+		return "", err
+	}
+
+	if _, err := writeCacheEntry(r.Cache, key, r.Url, r.Ref, r.Url, commit); err != nil {
+		return "", err
+	}
+
+	return src, nil
+}
+
+func writeCacheEntry(
+	cache string,
+	key string,
+	url string,
+	ref string,
+	source string,
+	commit string,
+) (*CacheEntry, error) {
+	e := &CacheEntry{
+		Key:     key,
+		Url:     url,
+		Ref:     ref,
+		Source:  source,
+		Commit:  commit,
+		Created: time.Now().UTC(),
+	}
+
+	data, err := json.MarshalIndent(e, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	return e, CreateFile(filepath.Join(cache, key+cacheSuffix), data, true)
+}
@@ -0,0 +1,262 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name string
+	link string
+	body string
+}
+
+// writeTestArchive packs entries into a .tar.gz, with the commit in a
+// global header like git archive writes it when set
+func writeTestArchive(t *testing.T, commit string, entries []testEntry) string {
+	t.Helper()
+
+	archive := filepath.Join(t.TempDir(), "test.tar.gz")
+
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if commit != "" {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": commit},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0644}
+
+		switch {
+		case e.link != "":
+			h.Typeflag = tar.TypeSymlink
+			h.Linkname = e.link
+		case strings.HasSuffix(e.name, "/"):
+			h.Typeflag = tar.TypeDir
+			h.Mode = 0755
+		default:
+			h.Typeflag = tar.TypeReg
+			h.Size = int64(len(e.body))
+		}
+
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archive
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		want    string
+		files   map[string]string
+	}{
+		{
+			name: "valid entries",
+			entries: []testEntry{
+				{name: "repo/"},
+				{name: "repo/main.tf", body: "main"},
+				{name: "repo/modules/"},
+				{name: "repo/link", link: "modules"},
+				{name: "repo/link/net.tf", body: "net"},
+				{name: "repo/up", link: "../repo/main.tf"},
+			},
+			files: map[string]string{
+				"repo/main.tf":        "main",
+				"repo/modules/net.tf": "net",
+				"repo/up":             "main",
+			},
+		},
+		{
+			name:    "parent path",
+			entries: []testEntry{{name: "../escape", body: "x"}},
+			want:    "outside of the archive",
+		},
+		{
+			name:    "nested parent path",
+			entries: []testEntry{{name: "repo/../../escape", body: "x"}},
+			want:    "outside of the archive",
+		},
+		{
+			name:    "absolute symlink",
+			entries: []testEntry{{name: "passwd", link: "/etc/passwd"}},
+			want:    "absolute path",
+		},
+		{
+			name:    "relative symlink leaving the archive",
+			entries: []testEntry{{name: "repo/up", link: "../../outside"}},
+			want:    "points outside of the archive",
+		},
+		{
+			name: "symlink chain leaving the archive",
+			entries: []testEntry{
+				{name: "repo/"},
+				{name: "repo/top", link: ".."},
+				{name: "repo/out", link: "top/../escape"},
+			},
+			want: "points outside of the archive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := writeTestArchive(t, "", tt.entries)
+			dst := filepath.Join(t.TempDir(), "dst")
+
+			err := ExtractArchive(archive, dst)
+
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("ExtractArchive() error = %v, want %q", err, tt.want)
+				}
+
+				if _, err := os.Stat(filepath.Join(filepath.Dir(dst), "escape")); err == nil {
+					t.Errorf("ExtractArchive() wrote outside of dst")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ExtractArchive() error = %v", err)
+			}
+
+			for name, body := range tt.files {
+				got, err := os.ReadFile(filepath.Join(dst, name))
+				if err != nil {
+					t.Errorf("ExtractArchive() missed %s: %v", name, err)
+				} else if string(got) != body {
+					t.Errorf("%s = %q, want %q", name, got, body)
+				}
+			}
+		})
+	}
+}
+
+func TestImportedCheckout(t *testing.T) {
+	const (
+		url    = "https://example.com/fast.git"
+		commit = "0123456789abcdef0123456789abcdef01234567"
+	)
+
+	cache := t.TempDir()
+
+	for _, ref := range []string{"refs/tags/v1.0.0", "refs/tags/v2.0.0"} {
+		archive := writeTestArchive(t, commit, []testEntry{
+			{name: "fast-1.0.0/"},
+			{name: "fast-1.0.0/README.md", body: ref},
+		})
+
+		e, err := ImportArchive(cache, archive, url, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Commit != commit {
+			t.Errorf("ImportArchive() commit = %q, want %q", e.Commit, commit)
+		}
+	}
+
+	r := &Repo{
+		Url:   url,
+		Ref:   "refs/tags/v1.0.0",
+		Dst:   filepath.Join(t.TempDir(), "fast"),
+		Cache: cache,
+	}
+
+	if err := r.Clone(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := r.Commit(); err != nil || got != commit {
+		t.Errorf("Commit() = %q, %v, want %q", got, err, commit)
+	}
+
+	if got, err := r.Describe(); err != nil || got != "v1.0.0" {
+		t.Errorf("Describe() = %q, %v, want v1.0.0", got, err)
+	}
+
+	// local changes are not read back as the upstream file
+	readme := filepath.Join(r.Dst, "README.md")
+	if err := os.WriteFile(readme, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := r.ReadHeadFile("README.md"); err != nil || string(got) != r.Ref {
+		t.Errorf("ReadHeadFile() = %q, %v, want %q", got, err, r.Ref)
+	}
+
+	if err := r.VerifyTag(""); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("VerifyTag() error = %v, want %v", err, ErrNoHistory)
+	}
+
+	// the same ref keeps the checkout, another one replaces it
+	if err := r.Clone(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(readme); string(got) != "changed" {
+		t.Errorf("Clone(false) replaced a checkout of the same ref")
+	}
+
+	r.Ref = "refs/tags/v2.0.0"
+
+	if err := r.Clone(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(readme); string(got) != r.Ref {
+		t.Errorf("Clone(false) kept a checkout of another ref: %q", got)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// ErrNoHistory is returned when a checkout was imported from an archive and
+// has no git history to read the commit or tag from
+var ErrNoHistory = errors.New("checkout has no git history")
+
+// checkoutFile records, inside the destination, what a checkout was cloned
+// from, so an archive import without a .git directory is still described
+const checkoutFile = ".pasture-checkout.json"
+
+// ReadCheckout reads the record of the checkout at the destination
+func (r *Repo) ReadCheckout() (*Checkout, error) {
+	data, err := os.ReadFile(filepath.Join(r.Dst, checkoutFile))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkout{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("checkout record of %s: %w", r.Dst, err)
+	}
+
+	return c, nil
+}
+
+// writeCheckout records the url, ref and commit of the checkout at the
+// destination, along with the cache entry it was copied from
+func (r *Repo) writeCheckout(commit string, cached string) error {
+	data, err := json.MarshalIndent(&Checkout{
+		Url:    r.Url,
+		Ref:    r.Ref,
+		Commit: commit,
+		Cached: cached,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return CreateFile(filepath.Join(r.Dst, checkoutFile), data, true)
+}
+
+// current reports whether the destination holds a checkout of the url and
+// ref of the repo
+func (r *Repo) current() bool {
+	c, err := r.ReadCheckout()
+	if err != nil {
+		return false
+	}
+
+	return c.Url == r.Url && c.Ref == r.Ref
+}
+
+// headCommit returns the commit checked out in a git working tree
+func headCommit(dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return "", fmt.Errorf("%s: %w", dir, ErrNoHistory)
+	} else if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+// ArchiveCommit returns the commit a .tar.gz was made from, as git archive
+// and GitHub release tarballs record it in the global header, or an empty
+// string when the archive does not say
+func ArchiveCommit(archive string) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+
+	defer gz.Close()
+
+	h, err := tar.NewReader(gz).Next()
+	if err == io.EOF {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if h.Typeflag != tar.TypeXGlobalHeader {
+		return "", nil
+	}
+
+	comment := h.PAXRecords["comment"]
+	if _, err := hex.DecodeString(comment); err != nil ||
+		(len(comment) != 40 && len(comment) != 64) {
+		return "", nil
+	}
+
+	return comment, nil
+}
+
+// readCached reads a file of the cache entry a checkout without git
+// history was copied from
+func (r *Repo) readCached(path string) ([]byte, error) {
+	c, err := r.ReadCheckout()
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && c.Cached == "") {
+		return nil, fmt.Errorf("%s: %w", r.Dst, ErrNoHistory)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(filepath.Join(c.Cached, path))
+}
+
+// describeImported describes a checkout without git history by the tag it
+// was imported as, or its recorded commit
+func (r *Repo) describeImported() (string, error) {
+	c, err := r.ReadCheckout()
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", r.Dst, ErrNoHistory)
+	} else if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(c.Ref, "refs/tags/") {
+		return strings.TrimPrefix(c.Ref, "refs/tags/"), nil
+	}
+
+	if c.Commit == "" {
+		return "", fmt.Errorf("%s: %w", r.Dst, ErrNoHistory)
+	}
+
+	return c.Commit, nil
+}
+
+// importedCommit returns the commit recorded for a checkout without git
+// history
+func (r *Repo) importedCommit() (string, error) {
+	c, err := r.ReadCheckout()
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && c.Commit == "") {
+		return "", fmt.Errorf("%s has no recorded commit: %w", r.Dst, ErrNoHistory)
+	} else if err != nil {
+		return "", err
+	}
+
+	return c.Commit, nil
+}
@@ -0,0 +1,256 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	diffContext = 3
+
+	// maxDiffEdits bounds the search of the shortest edit script, which
+	// keeps O(D²) memory
+	maxDiffEdits = 1000
+)
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff renders the line differences between two texts in the
+// unified format, or an empty string when they are the same
+func UnifiedDiff(from string, to string, a []byte, b []byte) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+
+	for start := 0; start < len(lines); {
+		// find the next change
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+		}
+
+		if start == len(lines) {
+			break
+		}
+
+		// extend the hunk until a gap wider than the context on both sides
+		end := start
+		for i := start; i < len(lines); i++ {
+			if lines[i].op != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+
+		lo := max(start-diffContext, 0)
+		hi := min(end+diffContext, len(lines))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+		}
+
+		aStart, bStart := position(lines, lo)
+		aLen, bLen := 0, 0
+
+		for _, l := range lines[lo:hi] {
+			if l.op != '+' {
+				aLen++
+			}
+
+			if l.op != '-' {
+				bLen++
+			}
+		}
+
+		// an empty range starts at the line before it
+		if aLen == 0 {
+			aStart--
+		}
+
+		if bLen == 0 {
+			bStart--
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+
+		for _, l := range lines[lo:hi] {
+			fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		}
+
+		start = hi
+	}
+
+	return out.String()
+}
+
+// position returns the 1-based line numbers in both texts of lines[i]
+func position(lines []diffLine, i int) (int, int) {
+	a, b := 1, 1
+
+	for _, l := range lines[:i] {
+		if l.op != '+' {
+			a++
+		}
+
+		if l.op != '-' {
+			b++
+		}
+	}
+
+	return a, b
+}
+
+// diffLines aligns two texts on a shortest edit script with Myers'
+// algorithm, in O((N+M)D) time and O(D²) memory for D changed lines. Texts
+// differing in more than maxDiffEdits lines are shown as replaced.
+func diffLines(a []string, b []string) []diffLine {
+	// common ends need no search
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre &&
+		a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+
+	for _, l := range a[:pre] {
+		lines = append(lines, diffLine{' ', l})
+	}
+
+	lines = append(lines, editScript(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+
+	for _, l := range a[len(a)-suf:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+
+	return lines
+}
+
+// editScript returns the shortest edit script from a to b, or a wholesale
+// replacement past maxDiffEdits changes
+func editScript(a []string, b []string) []diffLine {
+	n, m := len(a), len(b)
+
+	// trace[d][k+d] is the furthest x reached on diagonal k with d edits
+	trace := make([][]int, 0)
+
+	for d := 0; d <= min(n+m, maxDiffEdits); d++ {
+		v := make([]int, 2*d+1)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || (k != d && trace[d-1][k-1+d-1] < trace[d-1][k+1+d-1]):
+				x = trace[d-1][k+1+d-1] // down: insert from b
+			default:
+				x = trace[d-1][k-1+d-1] + 1 // right: delete from a
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[k+d] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, append(trace, v))
+			}
+		}
+
+		trace = append(trace, v)
+	}
+
+	lines := make([]diffLine, 0, n+m)
+
+	for _, l := range a {
+		lines = append(lines, diffLine{'-', l})
+	}
+
+	for _, l := range b {
+		lines = append(lines, diffLine{'+', l})
+	}
+
+	return lines
+}
+
+// backtrack walks the trace of editScript back from the end of both texts
+func backtrack(a []string, b []string, trace [][]int) []diffLine {
+	lines := make([]diffLine, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		prevX, prevY := 0, 0
+
+		if d > 0 {
+			prev := trace[d-1]
+			prevK := k - 1
+
+			if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+				prevK = k + 1
+			}
+
+			prevX = prev[prevK+d-1]
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			lines = append(lines, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, diffLine{'+', b[y-1]})
+			} else {
+				lines = append(lines, diffLine{'-', a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	slices.Reverse(lines)
+
+	return lines
+}
+
+func splitLines(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
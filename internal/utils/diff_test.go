@@ -0,0 +1,131 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "identical",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "insert only into empty",
+			b:    "a\nb\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete only to empty",
+			a:    "a\nb\n",
+			want: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "insert in the middle",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\nx\n5\n6\n7\n8\n",
+			want: "--- a\n+++ b\n@@ -2,6 +2,7 @@\n 2\n 3\n 4\n+x\n 5\n 6\n 7\n",
+		},
+		{
+			name: "delete in the middle",
+			a:    "1\n2\n3\n4\nx\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			want: "--- a\n+++ b\n@@ -2,7 +2,6 @@\n 2\n 3\n 4\n-x\n 5\n 6\n 7\n",
+		},
+		{
+			name: "change",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "distant changes make two hunks",
+			a:    "x\n1\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			b:    "X\n1\n2\n3\n4\n5\n6\n7\n8\nY\n",
+			want: "--- a\n+++ b\n" +
+				"@@ -1,4 +1,4 @@\n-x\n+X\n 1\n 2\n 3\n" +
+				"@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-y\n+Y\n",
+		},
+		{
+			name: "missing final newline is ignored",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("a", "b", []byte(tt.a), []byte(tt.b))
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+
+	edits := 0
+	for _, l := range diffLines(a, b) {
+		if l.op != ' ' {
+			edits++
+		}
+	}
+
+	// the shortest edit script of Myers' paper example
+	if edits != 5 {
+		t.Errorf("diffLines() made %d edits, want 5", edits)
+	}
+}
+
+func TestDiffLinesBounded(t *testing.T) {
+	n := 3 * maxDiffEdits
+
+	var a, b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+	}
+
+	lines := diffLines(splitLines([]byte(a.String())), splitLines([]byte(b.String())))
+
+	if len(lines) != 2*n {
+		t.Fatalf("diffLines() returned %d lines, want %d", len(lines), 2*n)
+	}
+
+	if lines[0].op != '-' || lines[n].op != '+' {
+		t.Errorf("diffLines() past the bound is not a wholesale replacement")
+	}
+}
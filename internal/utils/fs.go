@@ -63,6 +63,22 @@ func CreateFile(p string, d []byte, o bool) error {
 	return nil
 }
 
+func AppendFile(p string, d []byte) error {
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func ReadFile(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
 
@@ -148,3 +164,54 @@ func (s *Symlink) Link() error {
 
 	return nil
 }
+
+// CopyPath copies a file, or a directory and everything beneath it,
+// replacing whatever is at the destination. File modes and symlinks are
+// kept.
+func CopyPath(src string, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if d.Type()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
@@ -17,10 +17,28 @@ limitations under the License.
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/logging"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
+// ErrRefNotFound is returned when a repository has no such ref
+var ErrRefNotFound = errors.New("ref not found")
+
+// ErrNotCheckout is returned when a path is not inside a git checkout
+var ErrNotCheckout = errors.New("not inside a git checkout")
+
 func NewRepo() *Repo {
 	return &Repo{}
 }
@@ -42,36 +60,357 @@ func (r *Repo) SetLink(source string, target string) {
 	r.Link.SetTarget(target)
 }
 
+// SetCache shares checkouts of tags through the clone cache at dir
+func (r *Repo) SetCache(dir string) {
+	r.Cache = dir
+}
+
+// Clone checks the ref out at the destination. A checkout of the same url
+// and ref is kept unless force is set; any other is cloned again.
 func (r *Repo) Clone(force bool) error {
+	if !force && r.current() {
+		logging.Debug("keeping checkout", "url", r.Url, "ref", r.Ref, "dst", r.Dst)
+		return nil
+	}
+
+	logging.Debug("cloning repository", "url", r.Url, "ref", r.Ref, "dst", r.Dst)
+
+	// remove existing clone
+	if err := RemoveDir(r.Dst); err != nil {
+		return err
+	}
+
+	if r.Cache != "" && Cacheable(r.Ref) {
+		return r.cloneCached()
+	}
+
+	if err := r.fetch(r.Dst); err != nil {
+		return err
+	}
+
+	commit, err := headCommit(r.Dst)
+	if err != nil {
+		return err
+	}
+
+	return r.writeCheckout(commit, "")
+}
+
+// CheckRef verifies the ref exists in the repository before it is cloned.
+// Refs in the clone cache are not checked, so cached tags work offline.
+func (r *Repo) CheckRef() error {
+	if r.Ref == "" {
+		return nil
+	}
+
+	if r.Cache != "" && Cacheable(r.Ref) {
+		key := CacheKey(r.Url, r.Ref)
+		if _, err := os.Stat(filepath.Join(r.Cache, key)); err == nil {
+			return nil
+		}
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{r.Url},
+	})
+
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.Name().String() == r.Ref {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s in %s: %w", r.Ref, r.Url, ErrRefNotFound)
+}
+
+// fetch clones the ref into dst. Remote repositories are cloned shallow
+// and single branch. Local paths and file URLs are cloned in full, as
+// shallow clones are not supported over the file transport.
+func (r *Repo) fetch(dst string) error {
 	var options git.CloneOptions
-	var clone bool = false
 
 	// set options
 	options.URL = r.Url
 
 	if r.Ref != "" {
 		options.ReferenceName = plumbing.ReferenceName(r.Ref)
+		options.SingleBranch = true
 	}
 
-	// see if clone already exists
-	if err := FileExists(r.Dst); err != nil {
-		if force {
-			clone = true
+	if !isLocalURL(r.Url) {
+		options.Depth = 1
+	}
+
+	_, err := git.PlainClone(dst, false, &options)
+
+	return err
+}
+
+func isLocalURL(url string) bool {
+	if strings.HasPrefix(url, "file://") {
+		return true
+	}
+
+	return !strings.Contains(url, "://") && !strings.Contains(url, "@")
+}
+
+// Describe returns the tag checked out at the destination, or the commit
+// hash when HEAD does not match any tag. Checkouts imported from an archive
+// are described by the tag they were imported as.
+func (r *Repo) Describe() (string, error) {
+	var name string
+
+	repo, err := git.PlainOpen(r.Dst)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return r.describeImported()
+	} else if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := repo.Tags()
+	if err != nil {
+		return "", err
+	}
+
+	err = tags.ForEach(func(t *plumbing.Reference) error {
+		hash := t.Hash()
+
+		// annotated tags point at a tag object rather than the commit
+		if tag, err := repo.TagObject(hash); err == nil {
+			if c, err := tag.Commit(); err == nil {
+				hash = c.Hash
+			}
+		}
+
+		if hash == head.Hash() {
+			name = t.Name().Short()
+			return storer.ErrStop
 		}
-	} else {
-		clone = true
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		name = head.Hash().String()
+	}
+
+	return name, nil
+}
+
+// ReadHeadFile returns the content of a file in the commit checked out at
+// the destination, ignoring local changes. Checkouts imported from an
+// archive read the file from their cache entry.
+func (r *Repo) ReadHeadFile(path string) ([]byte, error) {
+	repo, err := git.PlainOpen(r.Dst)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return r.readCached(path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
 	}
 
-	if clone {
-		// remove existing clone
-		if err := RemoveDir(r.Dst); err != nil {
+	file, err := commit.File(filepath.ToSlash(path))
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fs.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(content), nil
+}
+
+// CopyHead writes path, a file or directory inside a git checkout, to dst
+// as it is in the commit checked out, without local changes. Paths the
+// commit does not have return fs.ErrNotExist.
+func CopyHead(path string, dst string) error {
+	real, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.PlainOpenWithOptions(
+		filepath.Dir(real),
+		&git.PlainOpenOptions{DetectDotGit: true},
+	)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return fmt.Errorf("%s: %w", path, ErrNotCheckout)
+	} else if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(wt.Filesystem.Root(), real)
+	if err != nil {
+		return err
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	if dir, err := tree.Tree(rel); err == nil {
+		if err := os.MkdirAll(dst, 0755); err != nil {
 			return err
 		}
 
-		// do what we came here to do
-		if _, err := git.PlainClone(r.Dst, false, &options); err != nil {
-			return err
+		return dir.Files().ForEach(func(f *object.File) error {
+			return writeHeadFile(f, filepath.Join(dst, filepath.FromSlash(f.Name)))
+		})
+	}
+
+	file, err := tree.File(rel)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return fs.ErrNotExist
+	} else if err != nil {
+		return err
+	}
+
+	return writeHeadFile(file, dst)
+}
+
+// resolvePath follows the symlinks of a path whose last element may not
+// exist yet
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real, nil
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+func writeHeadFile(f *object.File, dst string) error {
+	content, err := f.Contents()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	mode := fs.FileMode(0644)
+	if f.Mode.IsFile() {
+		if m, err := f.Mode.ToOSFileMode(); err == nil {
+			mode = m.Perm()
 		}
 	}
+
+	return os.WriteFile(dst, []byte(content), mode)
+}
+
+// Commit returns the hash of the commit checked out at the destination,
+// or the commit recorded when it was imported from an archive
+func (r *Repo) Commit() (string, error) {
+	repo, err := git.PlainOpen(r.Dst)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return r.importedCommit()
+	} else if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+// VerifyTag checks the signature of the tag cloned at the destination
+// against an armored PGP key ring. Checkouts imported from an archive
+// carry no tag and cannot be verified.
+func (r *Repo) VerifyTag(keyring string) error {
+	repo, err := git.PlainOpen(r.Dst)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return fmt.Errorf(
+			"%s was imported from an archive, so the signature of %s "+
+				"cannot be checked - verify the archive before importing it: %w",
+			r.Dst, r.Ref, ErrNoHistory,
+		)
+	} else if err != nil {
+		return err
+	}
+
+	ref, err := repo.Reference(plumbing.ReferenceName(r.Ref), true)
+	if err != nil {
+		return err
+	}
+
+	// lightweight tags point straight at the commit and cannot be signed
+	tag, err := repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return fmt.Errorf("%s is not an annotated tag and carries no signature", r.Ref)
+	} else if err != nil {
+		return err
+	}
+
+	if tag.PGPSignature == "" {
+		return fmt.Errorf("%s is not signed", r.Ref)
+	}
+
+	if _, err := tag.Verify(keyring); err != nil {
+		return fmt.Errorf("signature of %s: %w", r.Ref, err)
+	}
+
 	return nil
 }
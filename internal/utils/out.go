@@ -17,9 +17,10 @@ limitations under the License.
 package utils
 
 import (
-	"fmt"
 	"sync"
 	"time"
+
+	"github.com/GoogleCloudPlatform/pastures-poc-toolkit/internal/output"
 )
 
 func ProgressTicker(headline string, wg *sync.WaitGroup, ch <-chan bool) {
@@ -43,14 +44,16 @@ func ProgressTicker(headline string, wg *sync.WaitGroup, ch <-chan bool) {
 			seconds := int(elapsed.Seconds()) - minutes*60
 
 			if minutes == 0 {
-				fmt.Printf(
-					"Still working on %s for %d seconds\n",
+				output.Stagef(
+					headline,
+					"Still working on %s for %d seconds",
 					headline,
 					seconds,
 				)
 			} else {
-				fmt.Printf(
-					"Still working on %s for %d minutes and %d seconds\n",
+				output.Stagef(
+					headline,
+					"Still working on %s for %d minutes and %d seconds",
 					headline,
 					minutes,
 					seconds,
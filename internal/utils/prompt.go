@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// IsTerminal reports whether both stdin and stdout are attached to a terminal
+func IsTerminal() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		fi, err := f.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Prompt reads a line from stdin, returning def when the answer is empty
+func Prompt(question string, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+
+	return def, nil
+}
+
+// Select prints a numbered list of options and returns the chosen index
+func Select(question string, options []string) (int, error) {
+	if len(options) == 0 {
+		return -1, errors.New("nothing to select from")
+	}
+
+	fmt.Println(question)
+	for i, o := range options {
+		fmt.Printf("  %d) %s\n", i+1, o)
+	}
+
+	for {
+		answer, err := Prompt("Enter a number", "1")
+		if err != nil {
+			return -1, err
+		}
+
+		i, err := strconv.Atoi(answer)
+		if err == nil && i >= 1 && i <= len(options) {
+			return i - 1, nil
+		}
+
+		fmt.Printf("Please enter a number between 1 and %d\n", len(options))
+	}
+}
+
+// Confirm asks a yes or no question, defaulting to no
+func Confirm(question string) (bool, error) {
+	answer, err := Prompt(question+" (y/N)", "")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -16,14 +16,35 @@ limitations under the License.
 
 package utils
 
+import "time"
+
 type Repo struct {
-	Url  string
-	Dst  string
-	Ref  string
-	Link Symlink
+	Url   string
+	Dst   string
+	Ref   string
+	Link  Symlink
+	Cache string
+}
+
+// CacheEntry describes a repository checkout kept in the clone cache
+type CacheEntry struct {
+	Key     string    `json:"key" yaml:"key"`
+	Url     string    `json:"url" yaml:"url"`
+	Ref     string    `json:"ref" yaml:"ref"`
+	Source  string    `json:"source" yaml:"source"`
+	Commit  string    `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Created time.Time `json:"created" yaml:"created"`
+}
+
+// Checkout records what a repository destination was cloned from
+type Checkout struct {
+	Url    string `json:"url"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit,omitempty"`
+	Cached string `json:"cached,omitempty"`
 }
 
 type Symlink struct {
-	Source string
-	Target string
+	Source string `json:"source"`
+	Target string `json:"target"`
 }
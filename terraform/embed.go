@@ -0,0 +1,27 @@
+/*
+Copyright © 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package terraform embeds the pasture seed templates, so the binary always
+// carries the seeds it was released with
+package terraform
+
+import "embed"
+
+// Seeds holds a directory per seed template. New seeds must be added to
+// the embed pattern.
+//
+//go:embed data-cloud
+var Seeds embed.FS